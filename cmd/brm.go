@@ -0,0 +1,171 @@
+package main
+
+/*
+ * Buffered Read Mode (BRM): the reader scans autonomously and keeps tags seen in a data buffer
+ *
+ * read buffer request:  DATA-SETS(2), max number of records to read
+ * read buffer response: TR-DATA, DATA-SETS(2), {record}
+ * record:               [TR-TYPE, SNR-LEN, SNR] [ANT-NR] [TIMER(4)], as selected by TR-DATA
+ *
+ * Records read are removed from the buffer with CMD_CLEAR_BUFFER.
+ * A tag is reported again after BRM-VALID-TIME while in field, so a tag is in range
+ * as long as it has been seen within brmHold. Same for tags pushed in Notification Mode, see notify.go
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// TR-DATA flags, selecting data of buffer records
+const (
+	BRM_TR_DATA_UID   = 0x01
+	BRM_TR_DATA_ANT   = 0x10
+	BRM_TR_DATA_TIMER = 0x20
+)
+
+const (
+	brmMaxRecords = 64              // records per read buffer request
+	brmValidTime  = 5               // BRM-VALID-TIME, in 100ms steps
+	brmHold       = 2 * time.Second // tag removed when not seen for this long
+)
+
+// switch reader to Buffered Read Mode (in RAM, until reset) and clear data buffer
+func enableBufferedRead(d Device) error {
+	cb, err := readConfig(d, configFields["OPERATING-MODE"].Block, false)
+	if err != nil {
+		return err
+	}
+	if err := cb.SetField("OPERATING-MODE", OPMODE_BUFFERED); err != nil {
+		return err
+	}
+	if err := writeConfig(d, cb); err != nil {
+		return err
+	}
+	if cb, err = readConfig(d, configFields["BRM-TR-DATA"].Block, false); err != nil {
+		return err
+	}
+	if err := cb.SetField("BRM-TR-DATA", BRM_TR_DATA_UID|BRM_TR_DATA_ANT|BRM_TR_DATA_TIMER); err != nil {
+		return err
+	}
+	if err := cb.SetField("BRM-VALID-TIME", brmValidTime); err != nil {
+		return err
+	}
+	if err := writeConfig(d, cb); err != nil {
+		return err
+	}
+	return controlCommand(d, CMD_INIT_BUFFER, nil)
+}
+
+// read and clear all records in data buffer
+func readBuffer(d Device) ([]Tag, error) {
+	var tags []Tag
+	for i := 0; i < maxInventoryReads; i++ {
+		status, data, err := d.Command(CMD_READ_BUFFER, u16tob(brmMaxRecords))
+		if err != nil {
+			return tags, err
+		}
+		switch status {
+		case STATUS_OK, STATUS_MORE_DATA_AVAILABLE:
+		case STATUS_NO_VALID_DATA:
+			// buffer empty
+			return tags, nil
+		default:
+			return tags, &StatusError{Cmd: CMD_READ_BUFFER, Status: status}
+		}
+		ts, err := decodeBufferRecords(data)
+		if err != nil {
+			return tags, err
+		}
+		tags = append(tags, ts...)
+		if err := controlCommand(d, CMD_CLEAR_BUFFER, nil); err != nil {
+			return tags, err
+		}
+		if status != STATUS_MORE_DATA_AVAILABLE {
+			break
+		}
+	}
+	return tags, nil
+}
+
+// TR-DATA, DATA-SETS(2), {[TR-TYPE, SNR-LEN, SNR] [ANT-NR] [TIMER(4)]}
+func decodeBufferRecords(data []byte) ([]Tag, error) {
+	if len(data) < 3 {
+		return nil, errors.New("BUFFER RESPONSE: Not enough bytes")
+	}
+	trData, n := data[0], int(btou16(data[1:3]))
+	if trData&BRM_TR_DATA_UID == 0 {
+		return nil, errors.New("BUFFER RESPONSE: records without UID, check BRM-TR-DATA")
+	}
+	buf := data[3:]
+	tags := make([]Tag, 0, n)
+	for i := 0; i < n; i++ {
+		if len(buf) < 2 || len(buf) < 2+int(buf[1]) {
+			return tags, fmt.Errorf("BUFFER RESPONSE: record %d of %d truncated", i+1, n)
+		}
+		id := buf[2 : 2+buf[1]]
+		t := Tag{
+			Trtype: uint16(buf[0]),
+			Id:     id,
+			Mac:    tagIDtoMAC(id),
+		}
+		buf = buf[2+len(id):]
+		if trData&BRM_TR_DATA_ANT != 0 {
+			if len(buf) < 1 {
+				return tags, fmt.Errorf("BUFFER RESPONSE: record %d of %d truncated", i+1, n)
+			}
+			t.Antenna, buf = buf[0], buf[1:]
+		}
+		if trData&BRM_TR_DATA_TIMER != 0 {
+			if len(buf) < 4 {
+				return tags, fmt.Errorf("BUFFER RESPONSE: record %d of %d truncated", i+1, n)
+			}
+			buf = buf[4:]
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+// drain data buffer, and process tags seen within brmHold as inventory
+func (s *server) readBufferedTags() map[string]Tag {
+	tags, err := readBuffer(s.Reader)
+	if err != nil {
+		s.Log.Debugf("ERROR READING BUFFER: %v", err)
+		atomic.AddUint64(&s.Reader.Stats().ReadInvFail, 1)
+	} else {
+		atomic.AddUint64(&s.Reader.Stats().ReadInvSucc, 1)
+	}
+	s.checkConnection(err)
+	return s.processSeen(tags)
+}
+
+// add tags reported by an autonomous reader, and process tags seen within brmHold as inventory
+func (s *server) processSeen(tags []Tag) map[string]Tag {
+	s.processMu.Lock()
+	defer s.processMu.Unlock()
+	now := time.Now()
+	s.mu.Lock()
+	for _, t := range tags {
+		s.seen[t.Mac] = seenTag{Tag: t, At: now}
+	}
+	inv := &Inventory{Status: respStatus[STATUS_OK], Tags: make(map[string]Tag, len(s.seen))}
+	for k, st := range s.seen {
+		if now.Sub(st.At) > brmHold {
+			delete(s.seen, k)
+			continue
+		}
+		inv.Tags[k] = st.Tag
+	}
+	inv.Count = uint16(len(inv.Tags))
+	s.mu.Unlock()
+	return inv.Process(s)
+}
+
+// seenTag is a tag reported by reader, and when
+type seenTag struct {
+	Tag Tag
+	At  time.Time
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBufferedRead(t *testing.T) {
+	r := newVirtualReader(100)
+	defer r.Close()
+
+	if _, err := readBuffer(r); err == nil {
+		t.Errorf("Expected error reading buffer in host mode")
+	}
+	if err := enableBufferedRead(r); err != nil {
+		t.Fatalf("Enable Buffered Read Mode failed: %v", err)
+	}
+	r.sim.tags[0].Antenna = 2
+	tags, err := readBuffer(r)
+	if err != nil {
+		t.Fatalf("Read buffer failed: %v", err)
+	}
+	if len(tags) != 100 || tags[0].Mac != "E0:04:01:50:00:00:00:01" || tags[0].Antenna != 2 {
+		t.Fatalf("Wrong tags from buffer: %d, %#v", len(tags), tags[0])
+	}
+
+	s := newServer(r, false, Logger{}, "02030000")
+	s.opMode = OPMODE_BUFFERED
+	inv := s.ReadTagsInRange()
+	if len(inv) != 100 || inv["E0:04:01:50:00:00:00:01"].Content.Barcode != "03010000000001" {
+		t.Fatalf("Wrong inventory from buffer: %d tags", len(inv))
+	}
+	if st := r.Stats(); st.ReadInvSucc != 1 || st.ReadInvFail != 0 {
+		t.Errorf("Expected buffer read counted: %+v", st)
+	}
+
+	// tags not reported within brmHold are no longer in range
+	r.sim.remove(tags[0].Id)
+	s.mu.Lock()
+	for k, st := range s.seen {
+		st.At = time.Now().Add(-brmHold - time.Second)
+		s.seen[k] = st
+	}
+	s.mu.Unlock()
+	inv = s.ReadTagsInRange()
+	if _, ok := inv[tags[0].Mac]; ok || len(inv) != 99 {
+		t.Errorf("Expected removed tag gone from inventory, got %d tags", len(inv))
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+/*
+ * Reader configuration, read and written in blocks (CFG0, CFG1, ...) with CMD_READ_CONFIG and CMD_WRITE_CONFIG
+ *
+ * read request:   CFG-ADR
+ * read response:  CFG-REC (block data, 14 bytes on ID ISC readers)
+ * write request:  CFG-ADR CFG-REC
+ *
+ * CFG-ADR bit 7 selects EEPROM instead of RAM. Changes in EEPROM take effect after reset,
+ * changes in RAM are lost on reset.
+ */
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const configBlocks = 64 // CFG-ADR has 6 bits of block address
+
+var ErrConfigField error = errors.New("unknown configuration field")
+
+// configField is a named value in a configuration block, big endian if more than one byte
+type configField struct {
+	Block  byte
+	Offset int
+	Size   int
+}
+
+/*
+Named fields of the ID ISC.MR101/LR configuration, other readers differ, see the system manual of the reader.
+Bytes without a name can still be changed by block and offset
+*/
+var configFields = map[string]configField{
+	"COM-ADR":          {Block: 1, Offset: 0, Size: 1}, // bus address
+	"BAUD":             {Block: 1, Offset: 2, Size: 1},
+	"TRANS-FORM":       {Block: 1, Offset: 3, Size: 1}, // parity, data and stop bits
+	"TR-RESPONSE-TIME": {Block: 1, Offset: 5, Size: 2}, // max time for transponder commands, 100ms steps
+	"TAG-DRV":          {Block: 3, Offset: 0, Size: 2}, // enabled transponder drivers (protocols)
+	"RF-POWER":         {Block: 3, Offset: 2, Size: 1},
+	"ISO15693-MODE":    {Block: 4, Offset: 0, Size: 1}, // data rate and subcarrier
+	"ISO15693-AFI":     {Block: 4, Offset: 1, Size: 1}, // AFI used in inventory
+	"ANTICOLLISION":    {Block: 5, Offset: 0, Size: 1},
+	"ONT":              {Block: 5, Offset: 1, Size: 1}, // only new tag mode
+	"OPERATING-MODE":   {Block: 1, Offset: 13, Size: 1},
+	"BRM-TR-DATA":      {Block: 11, Offset: 0, Size: 1}, // data in Buffered Read Mode records
+	"BRM-VALID-TIME":   {Block: 11, Offset: 1, Size: 2}, // same tag reported again after, 100ms steps
+}
+
+// values of OPERATING-MODE
+const (
+	OPMODE_HOST         = 0x00
+	OPMODE_BUFFERED     = 0x80
+	OPMODE_NOTIFICATION = 0xC0
+)
+
+var opModeNames = map[byte]string{
+	OPMODE_HOST:         "HOST",
+	OPMODE_BUFFERED:     "BUFFERED",
+	OPMODE_NOTIFICATION: "NOTIFICATION",
+}
+
+// ConfigBlock is a single configuration block, with the named fields decoded
+type ConfigBlock struct {
+	Block  byte
+	EEPROM bool
+	Data   string // hex
+	Fields map[string]uint
+}
+
+// Config is a full reader configuration, as exported to file
+type Config struct {
+	Reader DeviceInfo
+	Blocks []ConfigBlock
+}
+
+func cfgAdr(block byte, eeprom bool) byte {
+	adr := block & CFG_ADR_MASK
+	if eeprom {
+		adr |= CFG_LOC_EEPROM
+	}
+	return adr
+}
+
+// read configuration block from RAM, or from EEPROM
+func readConfig(d Device, block byte, eeprom bool) (*ConfigBlock, error) {
+	status, data, err := d.Command(CMD_READ_CONFIG, []byte{cfgAdr(block, eeprom)})
+	if err != nil {
+		return nil, err
+	}
+	if status != STATUS_OK {
+		return nil, &StatusError{Cmd: CMD_READ_CONFIG, Status: status}
+	}
+	return newConfigBlock(block, eeprom, data), nil
+}
+
+// write configuration block to RAM, or to EEPROM
+func writeConfig(d Device, cb *ConfigBlock) error {
+	data, err := hex.DecodeString(cb.Data)
+	if err != nil {
+		return fmt.Errorf("configuration block %d: %w", cb.Block, err)
+	}
+	req := append([]byte{cfgAdr(cb.Block, cb.EEPROM)}, data...)
+	status, _, err := d.Command(CMD_WRITE_CONFIG, req)
+	if err != nil {
+		return err
+	}
+	if status != STATUS_OK {
+		return &StatusError{Cmd: CMD_WRITE_CONFIG, Status: status}
+	}
+	return nil
+}
+
+// copy configuration block from RAM to EEPROM, or all blocks, kept after reader reset
+func saveConfig(d Device, block byte, all bool) error {
+	adr := block & CFG_ADR_MASK
+	if all {
+		adr = CFG_MODE_ALL
+	}
+	status, _, err := d.Command(CMD_SAVE_CONFIG, []byte{adr})
+	if err != nil {
+		return err
+	}
+	if status != STATUS_OK {
+		return &StatusError{Cmd: CMD_SAVE_CONFIG, Status: status}
+	}
+	return nil
+}
+
+func newConfigBlock(block byte, eeprom bool, data []byte) *ConfigBlock {
+	cb := &ConfigBlock{
+		Block:  block,
+		EEPROM: eeprom,
+		Data:   hex.EncodeToString(data),
+		Fields: make(map[string]uint),
+	}
+	for name, f := range configFields {
+		if f.Block != block || f.Offset+f.Size > len(data) {
+			continue
+		}
+		var v uint
+		for _, b := range data[f.Offset : f.Offset+f.Size] {
+			v = v<<8 | uint(b)
+		}
+		cb.Fields[name] = v
+	}
+	return cb
+}
+
+// set named field in block to value
+func (cb *ConfigBlock) SetField(name string, value uint) error {
+	f, ok := configFields[name]
+	if !ok || f.Block != cb.Block {
+		return fmt.Errorf("%w '%s' in block %d", ErrConfigField, name, cb.Block)
+	}
+	if value >= 1<<(8*uint(f.Size)) {
+		return fmt.Errorf("value %d too large for %s", value, name)
+	}
+	for i := f.Size - 1; i >= 0; i-- {
+		if err := cb.SetByte(f.Offset+i, byte(value)); err != nil {
+			return err
+		}
+		value >>= 8
+	}
+	return nil
+}
+
+// set byte at offset in block to value
+func (cb *ConfigBlock) SetByte(offset int, value byte) error {
+	data, err := hex.DecodeString(cb.Data)
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset >= len(data) {
+		return fmt.Errorf("offset %d outside configuration block of %d bytes", offset, len(data))
+	}
+	data[offset] = value
+	*cb = *newConfigBlock(cb.Block, cb.EEPROM, data)
+	return nil
+}
+
+// read all configuration blocks the reader has in EEPROM
+func exportConfig(d Device) (*Config, error) {
+	cfg := &Config{Reader: d.Info()}
+	for b := byte(0); b < configBlocks; b++ {
+		cb, err := readConfig(d, b, true)
+		var se *StatusError
+		if errors.As(err, &se) {
+			// block not available in this reader
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		cfg.Blocks = append(cfg.Blocks, *cb)
+	}
+	if len(cfg.Blocks) == 0 {
+		return nil, errors.New("no configuration blocks read from reader")
+	}
+	return cfg, nil
+}
+
+// write all configuration blocks to EEPROM, takes effect after reader reset
+func importConfig(d Device, cfg *Config) error {
+	sort.Slice(cfg.Blocks, func(i, j int) bool { return cfg.Blocks[i].Block < cfg.Blocks[j].Block })
+	for _, cb := range cfg.Blocks {
+		cb.EEPROM = true
+		if err := writeConfig(d, &cb); err != nil {
+			return fmt.Errorf("writing configuration block %d: %w", cb.Block, err)
+		}
+	}
+	return nil
+}
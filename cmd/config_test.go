@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReaderConfig(t *testing.T) {
+	r := newVirtualReader(0)
+	defer r.Close()
+
+	cb, err := readConfig(r, 3, false)
+	if err != nil {
+		t.Fatalf("Read config failed: %v", err)
+	}
+	if err := cb.SetField("RF-POWER", 0x08); err != nil {
+		t.Fatalf("Set field failed: %v", err)
+	}
+	if err := cb.SetField("BAUD", 0x08); err == nil {
+		t.Errorf("Expected error setting field of another block")
+	}
+	if err := writeConfig(r, cb); err != nil {
+		t.Fatalf("Write config failed: %v", err)
+	}
+	cb, _ = readConfig(r, 3, false)
+	if cb.Fields["RF-POWER"] != 0x08 || cb.Data != "0000080000000000000000000000" {
+		t.Errorf("Wrong config block after write: %#v", cb)
+	}
+
+	// export from EEPROM of one reader, import to another
+	cb.EEPROM = true
+	cb.SetField("TAG-DRV", 0x0108)
+	writeConfig(r, cb)
+	cfg, err := exportConfig(r)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(cfg.Blocks) != virtualConfigBlocks {
+		t.Fatalf("Wrong number of exported blocks: %d", len(cfg.Blocks))
+	}
+	r2 := newVirtualReader(0)
+	defer r2.Close()
+	if err := importConfig(r2, cfg); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	cb2, _ := readConfig(r2, 3, true)
+	if cb2.Data != cb.Data || cb2.Fields["TAG-DRV"] != 0x0108 {
+		t.Errorf("Wrong config block after import: %#v", cb2)
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	r := newVirtualReader(0)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+	do := func(h func(*server, http.ResponseWriter, *http.Request), method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(s, w, httptest.NewRequest(method, url, nil))
+		return w
+	}
+
+	if w := do((*server).configHandler, "GET", "/config?block=3&field=RF-POWER&value=8"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected modify with GET refused, got %d", w.Code)
+	}
+	// refused before the reader is asked
+	closed := newVirtualReader(0)
+	closed.Close()
+	w := httptest.NewRecorder()
+	newServer(closed, false, Logger{}, "02030000").configHandler(w, httptest.NewRequest("GET", "/config?block=3&field=RF-POWER&value=8", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected modify with GET refused without reading config, got %d", w.Code)
+	}
+	if w := do((*server).configHandler, "POST", "/config?block=3&field=RF-POWER&value=8"); w.Code != http.StatusOK {
+		t.Fatalf("Modify config failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := do((*server).saveConfig, "GET", "/config/save?block=3"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected save with GET refused, got %d", w.Code)
+	}
+	if w := do((*server).saveConfig, "POST", "/config/save?block=3"); w.Code != http.StatusOK {
+		t.Fatalf("Save config failed: %d %s", w.Code, w.Body.String())
+	}
+	if cb, _ := readConfig(r, 3, true); cb.Fields["RF-POWER"] != 8 {
+		t.Errorf("Expected saved config in EEPROM: %#v", cb)
+	}
+
+	// all blocks
+	cb, _ := readConfig(r, 1, false)
+	cb.SetField("BAUD", 0x08)
+	writeConfig(r, cb)
+	if w := do((*server).saveConfig, "POST", "/config/save"); w.Code != http.StatusOK {
+		t.Fatalf("Save all config failed: %d %s", w.Code, w.Body.String())
+	}
+	if cb, _ := readConfig(r, 1, true); cb.Fields["BAUD"] != 0x08 {
+		t.Errorf("Expected all blocks saved in EEPROM: %#v", cb)
+	}
+}
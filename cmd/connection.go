@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// consecutive driver errors before a reader is considered disconnected
+const maxConnectionErrors = 5
+
+// backoff between reconnect attempts, doubled up to max
+var (
+	reconnectBackoffMin = 1 * time.Second
+	reconnectBackoffMax = 30 * time.Second
+)
+
+// Keep connection state of reader
+type connState int
+
+const (
+	connConnected connState = iota
+	connDisconnected
+)
+
+func (c connState) String() string {
+	return [...]string{"CONNECTED", "DISCONNECTED"}[c]
+}
+
+// ReaderEvent is sent with readerDisconnected and readerConnected events
+type ReaderEvent struct {
+	Reader string
+	Error  string
+}
+
+// errors not caused by an answering reader, i.e. reader might be gone
+func isConnectionError(err error) bool {
+	if err == nil || err.Error() == ErrResourceTempUnavailable.Error() || errors.Is(err, ErrInventoryEmpty) || errors.Is(err, ErrInventoryTruncated) {
+		return false
+	}
+	var se *StatusError
+	return !errors.As(err, &se)
+}
+
+// count connection errors, and start reconnecting after maxConnectionErrors in a row
+func (s *server) checkConnection(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !isConnectionError(err) {
+		s.connErrors = 0
+		return
+	}
+	s.connErrors++
+	if s.conn == connDisconnected || s.connErrors < maxConnectionErrors {
+		return
+	}
+	s.Log.Printf("Reader %s disconnected: %v", s.Id, err)
+	s.conn = connDisconnected
+	s.emit("readerDisconnected", ReaderEvent{Reader: s.Id, Error: err.Error()})
+	go s.reconnect()
+}
+
+// try reconnecting reader with backoff until it succeeds
+func (s *server) reconnect() {
+	backoff := reconnectBackoffMin
+	for {
+		time.Sleep(backoff)
+		err := s.Reader.Reconnect()
+		if err == nil {
+			// reader might have been restarted with configuration from EEPROM
+			err = s.setupReader()
+		}
+		if err == nil {
+			break
+		}
+		s.Log.Debugf("Reconnecting reader %s failed: %v", s.Id, err)
+		backoff *= 2
+		if backoff > reconnectBackoffMax {
+			backoff = reconnectBackoffMax
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Log.Printf("Reader %s reconnected", s.Id)
+	s.conn = connConnected
+	s.connErrors = 0
+	s.reconnects++
+	s.readerInfo = nil // might be another reader, or updated firmware
+	s.diagnosticRead = time.Time{}
+	s.emit("readerConnected", ReaderEvent{Reader: s.Id})
+}
+
+// apply antennas and operating mode, at start and again after reconnect
+func (s *server) setupReader() error {
+	s.Reader.SetAntennas(s.antennas)
+	if s.opMode == OPMODE_BUFFERED {
+		if err := enableBufferedRead(s.Reader); err != nil {
+			return fmt.Errorf("could not enable Buffered Read Mode: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *server) connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn == connConnected
+}
+
+// send event with data as json to event stream client
+func (s *server) emit(event string, data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		s.Log.Printf("ERROR encoding json: %s", err)
+		return
+	}
+	msg := EsMsg{Event: event, Data: b}
+	go func() {
+		s.broadcast <- msg
+	}()
+	s.signal(event)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnect(t *testing.T) {
+	reconnectBackoffMin = 10 * time.Millisecond
+	defer func() { reconnectBackoffMin = time.Second }()
+
+	r := newVirtualReader(1)
+	defer r.Close()
+	s := newServer(r, true, Logger{}, "02030000")
+	s.Id = "virtual"
+
+	// reader gone
+	r.Close()
+	for i := 0; i < maxConnectionErrors; i++ {
+		s.ReadTagsInRange()
+	}
+	for _, want := range []string{"readerDisconnected", "readerConnected"} {
+		select {
+		case msg := <-s.broadcast:
+			if msg.Event != want {
+				t.Fatalf("Expected %s event, got: %s %s", want, msg.Event, msg.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("No %s event", want)
+		}
+	}
+
+	s.mu.Lock()
+	status := s.ServerStatus()
+	s.mu.Unlock()
+	if status.Connection != "CONNECTED" || status.Reconnects != 1 {
+		t.Errorf("Wrong connection status: %s, %d reconnects", status.Connection, status.Reconnects)
+	}
+	if tags := s.ReadTagsInRange(); len(tags) != 1 {
+		t.Errorf("Expected tag after reconnect, got: %#v", tags)
+	}
+}
+
+func TestReconnectSetup(t *testing.T) {
+	reconnectBackoffMin = 10 * time.Millisecond
+	defer func() { reconnectBackoffMin = time.Second }()
+
+	r := newVirtualReader(1)
+	defer r.Close()
+	s := newServer(r, true, Logger{}, "02030000")
+	s.opMode = OPMODE_BUFFERED
+	s.antennas = 0x02
+	if err := s.setupReader(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reader restarted with configuration from EEPROM, and gone
+	controlCommand(r, CMD_CTRL_SOFT_RESET, nil)
+	r.SetAntennas(0)
+	r.Close()
+	for i := 0; i < maxConnectionErrors; i++ {
+		s.ReadTagsInRange()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-s.broadcast:
+		case <-time.After(time.Second):
+			t.Fatalf("No reconnect")
+		}
+	}
+
+	cb, err := readConfig(r, configFields["OPERATING-MODE"].Block, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := cb.Fields["OPERATING-MODE"]; mode != OPMODE_BUFFERED || r.Antennas != 0x02 {
+		t.Errorf("Expected setup redone after reconnect: mode 0x%02X, antennas 0x%02X", mode, r.Antennas)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+/*
+ * Reader control: reset and RF field
+ * The RF field can be switched off while no one is scanning, after server.rfIdle,
+ * and is switched on again when needed. Switching holds server.rfMu, not server.mu,
+ * so other requests are not blocked by reader I/O
+ */
+
+import (
+	"errors"
+	"time"
+)
+
+// restart reader (CPU reset), configuration is reloaded from EEPROM and RF is switched on
+func softReset(d Device) error {
+	return controlCommand(d, CMD_CTRL_SOFT_RESET, nil)
+}
+
+// reset RF controller of reader
+func systemReset(d Device) error {
+	return controlCommand(d, CMD_CTRL_SYST_RESET, []byte{0x00})
+}
+
+// switch RF field off for a moment, transponders power up again in ready state
+func rfReset(d Device) error {
+	return controlCommand(d, CMD_RF_RESET, nil)
+}
+
+// switch RF field on or off
+func setRF(d Device, on bool) error {
+	rf := byte(0x00)
+	if on {
+		rf = 0x01
+	}
+	return controlCommand(d, CMD_RF_ONOFF, []byte{rf})
+}
+
+func controlCommand(d Device, cmd byte, data []byte) error {
+	status, _, err := d.Command(cmd, data)
+	if err != nil {
+		return err
+	}
+	if status != STATUS_OK {
+		return &StatusError{Cmd: cmd, Status: status}
+	}
+	return nil
+}
+
+// switch RF on if it was switched off while idle, and keep it on for another idle period
+func (s *server) ensureRF() error {
+	s.rfMu.Lock()
+	defer s.rfMu.Unlock()
+	s.mu.Lock()
+	s.rfActive = time.Now()
+	on := s.rfOn
+	s.mu.Unlock()
+	if on {
+		return nil
+	}
+	if err := setRF(s.Reader, true); err != nil {
+		return err
+	}
+	s.Log.Debugf("RF on, reader %s", s.Id)
+	s.mu.Lock()
+	s.rfOn = true
+	s.mu.Unlock()
+	return nil
+}
+
+// switch RF off when not scanning and RF has not been used for rfIdle
+func (s *server) checkRFIdle() {
+	s.rfMu.Lock()
+	defer s.rfMu.Unlock()
+	s.mu.Lock()
+	idle := s.rfIdle
+	if idle == 0 || !s.rfOn || s.mode == modeScan || s.conn != connConnected || time.Since(s.rfActive) < idle {
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+	err := setRF(s.Reader, false)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		var se *StatusError
+		if errors.As(err, &se) {
+			// RF control not supported by reader, don't try again
+			s.rfIdle = 0
+		}
+		s.Log.Printf("Could not switch RF off, reader %s: %v", s.Id, err)
+		return
+	}
+	s.Log.Debugf("RF off after %s idle, reader %s", idle, s.Id)
+	s.rfOn = false
+}
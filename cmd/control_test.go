@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRFIdle(t *testing.T) {
+	r := newVirtualReader(1)
+	defer r.Close()
+	s := newServer(r, true, Logger{}, "02030000")
+	s.rfIdle = 20 * time.Millisecond
+
+	if tags := s.ReadTagsInRange(); len(tags) != 1 {
+		t.Fatalf("Expected tag in range, got: %#v", tags)
+	}
+	s.checkRFIdle()
+	if !s.rfOn {
+		t.Fatalf("RF switched off before idle period")
+	}
+	time.Sleep(30 * time.Millisecond)
+	s.checkRFIdle()
+	if s.rfOn || !r.sim.rfOff {
+		t.Fatalf("RF not switched off after idle period")
+	}
+
+	// RF is switched on again when needed
+	if tags := s.ReadTagsInRange(); len(tags) != 1 || r.sim.rfOff {
+		t.Errorf("Expected RF on and tag in range, got: %#v", tags)
+	}
+
+	setRF(r, false)
+	if err := softReset(r); err != nil || r.sim.rfOff {
+		t.Errorf("Expected RF on after soft reset: %v", err)
+	}
+
+	// quiet tags answer inventory again after RF reset
+	r.sim.tags[0].quiet = true
+	if err := rfReset(r); err != nil || r.sim.tags[0].quiet {
+		t.Errorf("Expected tag powered up again after RF reset: %v", err)
+	}
+}
+
+func TestRFIdleDoesNotBlockServer(t *testing.T) {
+	r := newVirtualReader(1)
+	defer r.Close()
+	s := newServer(r, true, Logger{}, "02030000")
+	s.rfIdle = time.Millisecond
+	s.ensureRF()
+	time.Sleep(5 * time.Millisecond)
+
+	// reader busy, server state can be read while RF is switched off
+	r.mu.Lock()
+	done := make(chan bool)
+	go func() {
+		s.checkRFIdle()
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	locked := make(chan bool)
+	go func() {
+		s.mu.Lock()
+		s.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Errorf("Server lock held during RF switching")
+	}
+	r.mu.Unlock()
+	<-done
+	if s.rfOn {
+		t.Errorf("Expected RF off after idle period")
+	}
+}
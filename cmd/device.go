@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Device is the common surface of a FEIG reader, regardless of transport (USB, serial or TCP)
+type Device interface {
+	ReadInventory() (*Inventory, error)
+	ReadTagContent(t *Tag) ([]byte, error)
+	WriteTagContent(t Tag) ([]byte, error)
+	WriteAFIByte(t Tag, afi byte) error
+	WriteDSFID(t Tag, dsfid byte) error
+	LockAFI(t Tag) error                  // permanently
+	LockDSFID(t Tag) error                // permanently
+	LockBlocks(t Tag, start, n int) error // write protect blocks, permanently
+	ResetToReady() error
+	GetSystemInformation(t *Tag) (*SystemInfo, error)
+	Info() DeviceInfo
+	Stats() *Counters
+	SetAntennas(ants byte)                               // ANT-SEL mask for inventory, bit 0 is antenna 1, 0 for reader default
+	Reconnect() error                                    // reopen connection and redo reader setup
+	Command(cmd byte, data []byte) (byte, []byte, error) // any host command, returns status and response data
+}
+
+// nxpDevice is a Device sending NXP ICODE custom commands, optional for readers
+type nxpDevice interface {
+	Device
+	nxpCommander
+	SetEAS(t Tag, on bool) error                    // NXP tags only
+	LockEAS(t Tag) error                            // permanently, NXP tags only
+	EASAlarm(t Tag) (bool, error)                   // EAS bit of NXP tag set
+	SetPassword(t Tag, id byte, pwd []byte) error   // NXP tags, tag without UID non-addressed
+	WritePassword(t Tag, id byte, pwd []byte) error // after SetPassword of id
+	EnablePrivacy(t Tag, pwd []byte) error
+	ProtectPage(t Tag, pointer, condition byte) error // after SetPassword of read and write password
+	ReadSignature(t Tag) ([]byte, error)              // NXP originality signature
+}
+
+var ErrNXPNotSupported error = errors.New("reader does not support NXP custom commands")
+
+// reader as nxpDevice, for NXP custom commands
+func (s *server) nxpReader() (nxpDevice, error) {
+	d, ok := s.Reader.(nxpDevice)
+	if !ok {
+		return nil, ErrNXPNotSupported
+	}
+	return d, nil
+}
+
+// DeviceInfo describes the connected reader
+type DeviceInfo struct {
+	Name   string
+	Family string
+	Serial string
+}
+
+// Counters keep read/write successes and failures, updated atomically
+type Counters struct {
+	ReadInvFail  uint64
+	ReadInvSucc  uint64
+	ReadTagFail  uint64
+	ReadTagSucc  uint64
+	WriteTagSucc uint64
+	WriteTagFail uint64
+	WriteAFISucc uint64
+	WriteAFIFail uint64
+	Counterfeit  uint64 // NXP tags failing originality check, see signature.go
+}
+
+func (s *server) ReadTagsInRange() map[string]Tag {
+	if err := s.ensureRF(); err != nil {
+		s.Log.Debugf("ERROR SWITCHING RF ON: %v", err)
+	}
+	if s.opMode == OPMODE_BUFFERED {
+		return s.readBufferedTags()
+	}
+	if s.opMode == OPMODE_NOTIFICATION {
+		// tags are pushed by reader, see notify.go
+		return s.processSeen(nil)
+	}
+	now := time.Now()
+	inv, err := s.Reader.ReadInventory()
+	s.Log.Debugf("INVENTORY TIMING: %s", time.Since(now))
+	if err != nil {
+		// don't count these, they come always
+		if err.Error() != ErrResourceTempUnavailable.Error() && err.Error() != ErrInventoryEmpty.Error() {
+			s.Log.Debugf("ERROR READING INVENTORY: %v", err)
+			atomic.AddUint64(&s.Reader.Stats().ReadInvFail, 1)
+		}
+	} else {
+		atomic.AddUint64(&s.Reader.Stats().ReadInvSucc, 1)
+	}
+	s.checkConnection(err)
+	if s.keepTranspondersAwake {
+		_ = s.Reader.ResetToReady()
+	}
+
+	return inv.Process(s)
+}
+
+/*
+Overwrite barcode on single tag
+*/
+func (s *server) WriteTagBarcode(tagId, barcode string) (Tag, error) {
+	if err := s.ensureRF(); err != nil {
+		return Tag{}, err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	tag := s.inventory[tagId]
+	s.mu.Unlock()
+	tag.Content.Barcode = barcode
+	err := s.withPasswords(tag, func() error {
+		_, err := s.Reader.WriteTagContent(tag)
+		return err
+	}, NXP_PWD_READ, NXP_PWD_WRITE)
+	if err != nil {
+		// don't count these, they come always
+		if err.Error() != ErrResourceTempUnavailable.Error() {
+			s.signal("writeTagFail")
+			s.Log.Debugf("ERROR WRITING TAG %s: %v", tagId, err)
+			return tag, err
+		}
+	}
+	s.mu.Lock()
+	s.inventory[tagId] = tag
+	s.mu.Unlock()
+	s.Log.Debugf("WRITE TIMING: %s", time.Since(now))
+	return tag, nil
+}
+
+/*
+TODO:
+
+	Might need to read inventory before writing, so we confirm right number of tags
+*/
+func (s *server) WriteToTagsInRange(barcode string) (map[string]Tag, error) {
+	if err := s.ensureRF(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	l := len(s.inventory)
+	c := 0
+	for id, tag := range s.inventory {
+		c++
+		tc := TagContent{
+			SeqNum:   uint8(c),
+			NumItems: uint8(l),
+			Barcode:  barcode,
+			Country:  "NO", // hard coded for now
+			Library:  s.library,
+		}
+		tag.Content = tc
+		err := s.withPasswords(tag, func() error {
+			_, err := s.Reader.WriteTagContent(tag)
+			return err
+		}, NXP_PWD_READ, NXP_PWD_WRITE)
+		if err != nil {
+			// don't count these, they come always
+			if err.Error() != ErrResourceTempUnavailable.Error() {
+				s.signal("writeTagFail")
+				s.Log.Debugf("ERROR WRITING TAG %s: %v", id, err)
+				return s.inventory, err
+			}
+		}
+		s.inventory[id] = tag
+	}
+
+	s.Log.Debugf("WRITE INVENTORY TIMING: %s", time.Since(now))
+	if c == l {
+		return s.inventory, nil
+	} else {
+		return s.inventory, errors.New("Wrong count of written tags")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+/*
+ * FEIG reader emulator
+ * Listens on TCP and speaks the host protocol as an ID ISC reader or Axe would,
+ * answering from a simulator with virtual transponders (see virtual.go)
+ * Built on its own with -tags emulator (see emulator_main.go), run with: feig-emulator -listen :10001 -tags 3
+ * and connect the API server to it with: -axeHost localhost -axePort 10001
+ */
+
+import (
+	"net"
+)
+
+type Emulator struct {
+	sim *simulator
+	Log Logger
+}
+
+func newEmulator(sim *simulator, lgr Logger) *Emulator {
+	sim.Log = lgr
+	return &Emulator{sim: sim, Log: lgr}
+}
+
+// accept connections and answer host protocol requests, one goroutine per connection
+func (e *Emulator) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		e.Log.Printf("Emulator: connection from %s", conn.RemoteAddr())
+		go func() {
+			defer conn.Close()
+			err := e.sim.serve(conn)
+			e.Log.Printf("Emulator: connection from %s closed: %v", conn.RemoteAddr(), err)
+		}()
+	}
+}
+
+func (e *Emulator) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	e.Log.Printf("Emulator listening at %s", ln.Addr())
+	return e.Serve(ln)
+}
@@ -0,0 +1,31 @@
+//go:build emulator
+
+package main
+
+/*
+ * Standalone FEIG reader emulator, built apart from the API server:
+ * go build -tags emulator -o ./build/feig-emulator ./cmd
+ */
+
+import (
+	"flag"
+	"log"
+)
+
+func main() {
+	l := Logger{}
+	l.Print("Starting feiging emulator...")
+	listen := flag.String("listen", ":10001", "TCP address to answer host protocol requests on")
+	tags := flag.Int("tags", 3, "number of simulated tags")
+	dropWrites := flag.Int("dropWrites", 0, "leave the first n write requests unanswered, like a reader timing out")
+	debug := flag.Bool("debug", false, "turn on verbose logging")
+	flag.Parse()
+
+	if *debug {
+		l.PrintDebug = true
+	}
+
+	sim := newSimulator(*tags)
+	sim.DropWrites = *dropWrites
+	log.Fatal(newEmulator(sim, l).ListenAndServe(*listen))
+}
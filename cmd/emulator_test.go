@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func startEmulator(t *testing.T, sim *simulator) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go newEmulator(sim, Logger{}).Serve(ln)
+	return ln.Addr().String()
+}
+
+func TestEmulatorReaderInfo(t *testing.T) {
+	r, err := dialISC(startEmulator(t, newSimulator(1)))
+	if err != nil {
+		t.Fatalf("Could not connect to emulator: %v", err)
+	}
+	defer r.Close()
+
+	status, d, err := r.Command(CMD_GET_READER_INFO, []byte{0x00})
+	if err != nil || status != STATUS_OK {
+		t.Fatalf("Reader info failed: status 0x%02X, %v", status, err)
+	}
+	if !bytes.Equal(d, virtualReaderInfo) {
+		t.Errorf("Wrong reader info: % 02X", d)
+	}
+	status, _, _ = r.Command(CMD_SYSTEM_TIMER, nil)
+	if status != STATUS_UNKNOWN_COMMAND {
+		t.Errorf("Expected unknown command, got status 0x%02X", status)
+	}
+}
+
+// writes not answered in time are retried, as with FEISC error -1130
+func TestEmulatorWriteRetry(t *testing.T) {
+	sim := newSimulator(1)
+	sim.DropWrites = 2
+	r, err := dialISC(startEmulator(t, sim))
+	if err != nil {
+		t.Fatalf("Could not connect to emulator: %v", err)
+	}
+	defer r.Close()
+	r.timeout = 100 * time.Millisecond
+
+	inv, err := r.ReadInventory()
+	if err != nil || len(inv.Tags) != 1 {
+		t.Fatalf("Inventory failed: %#v, %v", inv, err)
+	}
+	tag := inv.Tags["E0:04:01:50:00:00:00:01"]
+	tag.Content = TagContent{SeqNum: 1, NumItems: 1, Barcode: "03011339851014", Country: "NO", Library: "02030000"}
+	if _, err := r.WriteTagContent(tag); err != nil {
+		t.Fatalf("Write was not retried: %v", err)
+	}
+	if r.WriteTagSucc != 1 || r.WriteTagFail != 0 {
+		t.Errorf("Wrong write counters: %d success, %d fail", r.WriteTagSucc, r.WriteTagFail)
+	}
+}
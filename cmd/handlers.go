@@ -2,11 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -17,52 +18,32 @@ type EsMsg struct {
 
 var semaphore = make(chan struct{}, 1)
 
-// request handler for event source stream
-func (s *server) esHandler(w http.ResponseWriter, r *http.Request) {
-	// Limit to 1 synchronous client
-	defer func() { <-semaphore }()
-	select {
-	case semaphore <- struct{}{}:
-	case <-time.After(2 * time.Second):
-		http.Error(w, "Busy, only tab at a time please!", http.StatusServiceUnavailable)
-		return
-	}
-
-	// Make sure that the writer supports flushing.
-	f, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
-		return
-	}
-
-	// Create a new channel for messages
-	msgChan := make(chan EsMsg)
-	s.register <- msgChan
-
-	// request context done? client disconnected, so unregister
-	notify := r.Context().Done()
-	go func() {
-		<-notify
-		s.unregister <- msgChan
-		log.Println("HTTP connection just closed.")
-	}()
-
-	// EventStream headers
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	for msg := range msgChan {
-
-		// Write to the ResponseWriter, `w`.
-		fmt.Fprintf(w, "event: %s\n", msg.Event)
-		fmt.Fprintf(w, "data: %s\n\n", msg.Data)
-
-		// Flush the response.  This is only possible if the repsonse supports streaming.
-		f.Flush()
-	}
-
-	log.Println("Finished HTTP request at ", r.URL.Path)
+// routes of a single reader, served at top level for the first reader and at /readers/{id}/ for all
+var readerRoutes = map[string]func(*server, http.ResponseWriter, *http.Request){
+	"/.status":         (*server).statusHandler,
+	"/scan":            (*server).scanOnce,
+	"/start":           (*server).handleStart,
+	"/stop":            (*server).handleStop,
+	"/write":           (*server).writeTags,
+	"/writetagbarcode": (*server).writeTagBarcode,
+	"/alarmOff":        (*server).alarmOff,
+	"/alarmOn":         (*server).alarmOn,
+	"/writeDSFID":      (*server).writeDSFID,
+	"/lockAFI":         (*server).lockAFI,
+	"/lockDSFID":       (*server).lockDSFID,
+	"/lockEAS":         (*server).lockEAS,
+	"/lockBlocks":      (*server).lockBlocks,
+	"/writePassword":   (*server).writePassword,
+	"/protectPage":     (*server).protectPage,
+	"/privacy":         (*server).privacy,
+	"/antennas":        (*server).selectAntennas,
+	"/config":          (*server).configHandler,
+	"/config/save":     (*server).saveConfig,
+	"/config/export":   (*server).exportConfig,
+	"/config/import":   (*server).importConfig,
+	"/reset":           (*server).resetReader,
+	"/rf":              (*server).rfHandler,
+	"/output":          (*server).outputHandler,
 }
 
 func (s *server) statusHandler(w http.ResponseWriter, r *http.Request) {
@@ -82,7 +63,7 @@ func (s *server) scanOnce(w http.ResponseWriter, r *http.Request) {
 	orig := s.mode
 	s.mode = modeReadOnce
 	s.mu.Unlock()
-	t := s.Reader.ReadTagsInRange(s)
+	t := s.ReadTagsInRange()
 	b, err := json.Marshal(t)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -126,7 +107,7 @@ func (s *server) writeTagBarcode(w http.ResponseWriter, r *http.Request) {
 	s.mu.Lock()
 	s.mode = modeWrite
 	s.mu.Unlock()
-	tag, err := s.Reader.WriteTagBarcode(s, tagid[0], barcode[0])
+	tag, err := s.WriteTagBarcode(tagid[0], barcode[0])
 	if err != nil {
 		http.Error(w, "Error writing tag: "+err.Error(), http.StatusBadRequest)
 		s.mu.Lock()
@@ -172,7 +153,7 @@ func (s *server) writeTags(w http.ResponseWriter, r *http.Request) {
 	s.mu.Lock()
 	s.mode = modeWrite
 	s.mu.Unlock()
-	inv, err := s.Reader.WriteToTagsInRange(s, barcode[0])
+	inv, err := s.WriteToTagsInRange(barcode[0])
 	if err != nil {
 		http.Error(w, "Error writing inventory: "+err.Error(), http.StatusBadRequest)
 		s.mu.Lock()
@@ -196,10 +177,14 @@ func (s *server) writeTags(w http.ResponseWriter, r *http.Request) {
 }
 
 /*
-Turn off alarm on all tags in range
+Turn off alarm on all tags in range, with AFI or EAS as given by -security
 Uses last read inventory
 */
 func (s *server) alarmOff(w http.ResponseWriter, r *http.Request) {
+	if err := s.ensureRF(); err != nil {
+		http.Error(w, "Error switching RF on: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	orig := s.mode
@@ -209,7 +194,11 @@ func (s *server) alarmOff(w http.ResponseWriter, r *http.Request) {
 	}
 	s.mode = modeWriteAFI
 	for id, tag := range s.inventory {
-		if err := s.Reader.WriteAFIByte(tag, 0xc2); err != nil {
+		err := s.withPasswords(tag, func() error {
+			return s.security.setAlarm(s, id, tag, false)
+		}, NXP_PWD_EAS_AFI)
+		if err != nil {
+			s.signal("writeAFIFail")
 			http.Error(w, fmt.Sprintf("Failed activating alarm on id %s, err: %s ", id, err.Error()), http.StatusInternalServerError)
 			s.mode = orig
 			return
@@ -220,6 +209,10 @@ func (s *server) alarmOff(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) alarmOn(w http.ResponseWriter, r *http.Request) {
+	if err := s.ensureRF(); err != nil {
+		http.Error(w, "Error switching RF on: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	orig := s.mode
@@ -230,7 +223,11 @@ func (s *server) alarmOn(w http.ResponseWriter, r *http.Request) {
 	}
 	s.mode = modeWriteAFI
 	for id, tag := range s.inventory {
-		if err := s.Reader.WriteAFIByte(tag, 0x07); err != nil {
+		err := s.withPasswords(tag, func() error {
+			return s.security.setAlarm(s, id, tag, true)
+		}, NXP_PWD_EAS_AFI)
+		if err != nil {
+			s.signal("writeAFIFail")
 			http.Error(w, fmt.Sprintf("Failed activating alarm on id %s, err: %s ", id, err.Error()), http.StatusInternalServerError)
 			s.mode = orig
 			return
@@ -240,7 +237,528 @@ func (s *server) alarmOn(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+// tags of a tag request: the tag given by param tagid, or all tags in range; s.mu must be held
+func (s *server) requestTags(r *http.Request) (map[string]Tag, error) {
+	if len(s.inventory) == 0 {
+		return nil, errors.New("Inventory empty")
+	}
+	id := r.URL.Query().Get("tagid")
+	if id == "" {
+		return s.inventory, nil
+	}
+	tag, ok := s.inventory[id]
+	if !ok {
+		return nil, fmt.Errorf("Tag %s not in range", id)
+	}
+	return map[string]Tag{id: tag}, nil
+}
+
+/*
+Write DSFID to tags in range, e.g. 0x3E to declare the Danish data model
+input params: value, tagid (optional, default all tags in range)
+*/
+func (s *server) writeDSFID(w http.ResponseWriter, r *http.Request) {
+	value, err := strconv.ParseUint(r.URL.Query().Get("value"), 0, 8)
+	if err != nil {
+		http.Error(w, "Url Param 'value' must be 0-255", http.StatusBadRequest)
+		return
+	}
+	if err := s.ensureRF(); err != nil {
+		http.Error(w, "Error switching RF on: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tags, err := s.requestTags(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	orig := s.mode
+	s.mode = modeWrite
+	defer func() { s.mode = orig }()
+	for id, tag := range tags {
+		if err := s.Reader.WriteDSFID(tag, byte(value)); err != nil {
+			http.Error(w, fmt.Sprintf("Failed writing DSFID on id %s, err: %s ", id, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		s.updateDSFID(id, byte(value))
+	}
+	w.Write([]byte("OK"))
+}
+
+/*
+Permanently lock AFI of tags in range, alarm can not be changed afterwards
+input params: confirm (must be yes), tagid (optional, default all tags in range)
+*/
+func (s *server) lockAFI(w http.ResponseWriter, r *http.Request) {
+	s.lockTags(w, r, "AFI", nil, s.Reader.LockAFI)
+}
+
+/*
+Permanently lock DSFID of tags in range
+input params: confirm (must be yes), tagid (optional, default all tags in range)
+*/
+func (s *server) lockDSFID(w http.ResponseWriter, r *http.Request) {
+	s.lockTags(w, r, "DSFID", nil, s.Reader.LockDSFID)
+}
+
+/*
+Permanently lock EAS of NXP tags in range
+input params: confirm (must be yes), tagid (optional, default all tags in range)
+*/
+func (s *server) lockEAS(w http.ResponseWriter, r *http.Request) {
+	d, err := s.nxpReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.lockTags(w, r, "EAS", nil, func(t Tag) error {
+		if !isNXP(&t) {
+			return ErrEASNotSupported
+		}
+		return d.LockEAS(t)
+	})
+}
+
+/*
+Permanently write protect blocks of tags in range, e.g. the barcode and ISIL of newly tagged items
+input params: confirm (must be yes), tagid (optional, default all tags in range),
+start and count (optional, default all blocks of the data model)
+*/
+func (s *server) lockBlocks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, err := strconv.ParseUint(q.Get("start"), 0, 8)
+	if q.Get("start") != "" && err != nil {
+		http.Error(w, "Url Param 'start' must be 0-255", http.StatusBadRequest)
+		return
+	}
+	count, err := strconv.ParseUint(q.Get("count"), 0, 8)
+	if q.Get("count") != "" && (err != nil || count == 0) {
+		http.Error(w, "Url Param 'count' must be 1-255", http.StatusBadRequest)
+		return
+	}
+	// number of blocks to lock on tag, checked against its memory before anything is locked
+	blocks := func(t Tag) (int, error) {
+		n := int(count)
+		if n == 0 {
+			var err error
+			if n, err = tagLayout(&t).dataBlocks(); err != nil {
+				return 0, err
+			}
+			n -= int(start)
+		}
+		if n <= 0 || int(start)+n > tagLayout(&t).Blocks {
+			return 0, fmt.Errorf("blocks %d-%d out of range, tag %s has %d blocks", start, int(start)+n-1, t.Mac, tagLayout(&t).Blocks)
+		}
+		return n, nil
+	}
+	s.lockTags(w, r, "blocks", func(t Tag) error {
+		_, err := blocks(t)
+		return err
+	}, func(t Tag) error {
+		n, err := blocks(t)
+		if err != nil {
+			return err
+		}
+		if err := s.Reader.LockBlocks(t, int(start), n); err != nil {
+			return err
+		}
+		s.updateLockedBlocks(t.Mac, int(start), n)
+		return nil
+	})
+}
+
+/*
+Write configured password to NXP tags in range, e.g. to protect new tags with factory passwords
+input params: pwd (read, write, privacy, destroy or easafi), old (password on tag, default 00000000),
+tagid (optional, default all tags in range)
+*/
+func (s *server) writePassword(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id, ok := passwordIds[q.Get("pwd")]
+	if !ok {
+		http.Error(w, "Url Param 'pwd' must be read, write, privacy, destroy or easafi", http.StatusBadRequest)
+		return
+	}
+	pwd, ok := s.passwords[id]
+	if !ok {
+		http.Error(w, "No "+q.Get("pwd")+" password configured", http.StatusBadRequest)
+		return
+	}
+	old := []byte{0x00, 0x00, 0x00, 0x00}
+	if q.Get("old") != "" {
+		var err error
+		if old, err = parsePassword(q.Get("old")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	s.nxpTags(w, r, "writing password", func(d nxpDevice, t Tag) error {
+		if err := d.SetPassword(t, id, old); err != nil {
+			return err
+		}
+		return d.WritePassword(t, id, pwd)
+	})
+}
+
+/*
+Protect pages of NXP tags in range with the configured read and write passwords
+input params: pointer (first block of high page), condition (PP-CONDITION, bit 0/1 read/write protects
+low page, bit 4/5 high page), tagid (optional, default all tags in range)
+*/
+func (s *server) protectPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pointer, err := strconv.ParseUint(q.Get("pointer"), 0, 8)
+	if err != nil {
+		http.Error(w, "Url Param 'pointer' must be 0-255", http.StatusBadRequest)
+		return
+	}
+	condition, err := strconv.ParseUint(q.Get("condition"), 0, 8)
+	if err != nil {
+		http.Error(w, "Url Param 'condition' must be 0-255", http.StatusBadRequest)
+		return
+	}
+	if s.passwords[NXP_PWD_READ] == nil || s.passwords[NXP_PWD_WRITE] == nil {
+		http.Error(w, "Read and write passwords must be configured", http.StatusBadRequest)
+		return
+	}
+	s.nxpTags(w, r, "protecting page", func(d nxpDevice, t Tag) error {
+		if _, err := s.setPasswords(t, NXP_PWD_READ, NXP_PWD_WRITE); err != nil {
+			return err
+		}
+		return d.ProtectPage(t, byte(pointer), byte(condition))
+	})
+}
+
+/*
+Switch privacy mode of NXP tags with the configured privacy password. Tags in privacy mode do not answer
+until privacy is turned off, which is done for the single tag in the field, until it is powered up again.
+input params: on (1 or 0), confirm (must be yes when turning on), tagid (optional when turning on,
+default all tags in range)
+*/
+func (s *server) privacy(w http.ResponseWriter, r *http.Request) {
+	pwd, ok := s.passwords[NXP_PWD_PRIVACY]
+	if !ok {
+		http.Error(w, "No privacy password configured", http.StatusBadRequest)
+		return
+	}
+	switch r.URL.Query().Get("on") {
+	case "1":
+		if r.URL.Query().Get("confirm") != "yes" {
+			http.Error(w, "Tags in privacy mode can not be seen until privacy is turned off, confirm with Url Param 'confirm=yes'", http.StatusBadRequest)
+			return
+		}
+		s.nxpTags(w, r, "enabling privacy", func(d nxpDevice, t Tag) error {
+			return d.EnablePrivacy(t, pwd)
+		})
+	case "0":
+		d, err := s.nxpReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := s.ensureRF(); err != nil {
+			http.Error(w, "Error switching RF on: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// tag in privacy mode has no UID, wake it up non-addressed
+		if err := d.SetPassword(Tag{}, NXP_PWD_PRIVACY, pwd); err != nil {
+			http.Error(w, "Failed disabling privacy, err: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("OK"))
+	default:
+		http.Error(w, "Url Param 'on' must be 1 or 0", http.StatusBadRequest)
+	}
+}
+
+// run NXP command on tags of request, other tags are refused
+func (s *server) nxpTags(w http.ResponseWriter, r *http.Request, what string, command func(nxpDevice, Tag) error) {
+	d, err := s.nxpReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.tagsCommand(w, r, what, func(t Tag) error {
+		if !isNXP(&t) {
+			return fmt.Errorf("Tag %s is not an NXP tag", t.Mac)
+		}
+		return nil
+	}, func(t Tag) error {
+		return command(d, t)
+	})
+}
+
+// lock field of requested tags after confirmation, check (optional) refuses the request before anything is locked
+func (s *server) lockTags(w http.ResponseWriter, r *http.Request, field string, check, lock func(Tag) error) {
+	if r.URL.Query().Get("confirm") != "yes" {
+		http.Error(w, "Locking "+field+" can not be undone, confirm with Url Param 'confirm=yes'", http.StatusBadRequest)
+		return
+	}
+	s.tagsCommand(w, r, "locking "+field, check, func(t Tag) error {
+		if err := lock(t); err != nil {
+			return err
+		}
+		s.Log.Printf("Locked %s of tag %s", field, t.Mac)
+		return nil
+	})
+}
+
+// run command on tags of request in write mode, check (optional) refuses the request before any command is run
+func (s *server) tagsCommand(w http.ResponseWriter, r *http.Request, what string, check, command func(Tag) error) {
+	if err := s.ensureRF(); err != nil {
+		http.Error(w, "Error switching RF on: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tags, err := s.requestTags(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if check != nil {
+		for _, tag := range tags {
+			if err := check(tag); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	orig := s.mode
+	s.mode = modeWrite
+	defer func() { s.mode = orig }()
+	for id, tag := range tags {
+		if err := command(tag); err != nil {
+			http.Error(w, fmt.Sprintf("Failed %s on id %s, err: %s ", what, id, err.Error()), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Write([]byte("OK"))
+}
+
+/*
+Select antennas used for inventory
+input param: select, comma separated antenna numbers (1-8), empty for reader default
+*/
+func (s *server) selectAntennas(w http.ResponseWriter, r *http.Request) {
+	mask, err := parseAntennas(r.URL.Query().Get("select"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.Reader.SetAntennas(mask)
+	w.Write([]byte("OK"))
+}
+
+/*
+Read configuration block, and modify it if value is given
+input params: block (0-63), eeprom (1 for EEPROM, default RAM),
+field (named field, see configFields) or offset (byte in block), value
+*/
+func (s *server) configHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	block, err := strconv.ParseUint(q.Get("block"), 0, 8)
+	if err != nil || block >= configBlocks {
+		http.Error(w, "Url Param 'block' must be 0-63", http.StatusBadRequest)
+		return
+	}
+	if q.Get("value") != "" && r.Method != http.MethodPost {
+		http.Error(w, "POST to modify configuration", http.StatusMethodNotAllowed)
+		return
+	}
+	eeprom := q.Get("eeprom") == "1"
+	cb, err := readConfig(s.Reader, byte(block), eeprom)
+	if err != nil {
+		http.Error(w, "Error reading configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if v := q.Get("value"); v != "" {
+		value, err := strconv.ParseUint(v, 0, 32)
+		if err != nil {
+			http.Error(w, "Url Param 'value' must be a number", http.StatusBadRequest)
+			return
+		}
+		if field := q.Get("field"); field != "" {
+			err = cb.SetField(field, uint(value))
+		} else if offset, oerr := strconv.Atoi(q.Get("offset")); oerr == nil && value <= 0xFF {
+			err = cb.SetByte(offset, byte(value))
+		} else {
+			err = errors.New("Url Param 'field' or 'offset' with byte value is missing")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := writeConfig(s.Reader, cb); err != nil {
+			http.Error(w, "Error writing configuration: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	b, err := json.Marshal(cb)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// copy configuration from RAM to EEPROM, block given or all blocks, used after reader reset
+func (s *server) saveConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST to save configuration", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	all := q.Get("block") == ""
+	block, err := strconv.ParseUint(q.Get("block"), 0, 8)
+	if !all && (err != nil || block >= configBlocks) {
+		http.Error(w, "Url Param 'block' must be 0-63, or left out for all blocks", http.StatusBadRequest)
+		return
+	}
+	if err := saveConfig(s.Reader, byte(block), all); err != nil {
+		http.Error(w, "Error saving configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// download full reader configuration (EEPROM) as file
+func (s *server) exportConfig(w http.ResponseWriter, r *http.Request) {
+	cfg, err := exportConfig(s.Reader)
+	if err != nil {
+		http.Error(w, "Error reading configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"feig-config-%s.json\"", s.Id))
+	w.Write(b)
+}
+
+// upload configuration file as exported, written to EEPROM and used after reader reset
+func (s *server) importConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST configuration file", http.StatusMethodNotAllowed)
+		return
+	}
+	var cfg Config
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "Invalid configuration file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := importConfig(s.Reader, &cfg); err != nil {
+		http.Error(w, "Error writing configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+/*
+Reset reader
+input param: mode, soft (default) restarts reader, system resets RF controller,
+rf switches RF off for a moment so transponders power up again
+*/
+func (s *server) resetReader(w http.ResponseWriter, r *http.Request) {
+	s.rfMu.Lock()
+	defer s.rfMu.Unlock()
+	var err error
+	switch r.URL.Query().Get("mode") {
+	case "", "soft":
+		err = softReset(s.Reader)
+	case "system":
+		err = systemReset(s.Reader)
+	case "rf":
+		err = rfReset(s.Reader)
+	default:
+		http.Error(w, "Url Param 'mode' must be soft, system or rf", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error resetting reader: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.rfOn = true // reader starts with RF on
+	s.rfActive = time.Now()
+	s.mu.Unlock()
+	w.Write([]byte("OK"))
+}
+
+/*
+Switch RF field on or off
+input param: on, 1 or 0
+*/
+func (s *server) rfHandler(w http.ResponseWriter, r *http.Request) {
+	on := r.URL.Query().Get("on")
+	if on != "0" && on != "1" {
+		http.Error(w, "Url Param 'on' must be 1 or 0", http.StatusBadRequest)
+		return
+	}
+	s.rfMu.Lock()
+	defer s.rfMu.Unlock()
+	if err := setRF(s.Reader, on == "1"); err != nil {
+		http.Error(w, "Error switching RF: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	s.rfOn = on == "1"
+	s.rfActive = time.Now()
+	s.mu.Unlock()
+	w.Write([]byte("OK"))
+}
+
+/*
+Set digital output of reader
+input params: out (led, buzzer, relay or other name given with -outputs, or out1, rel1, ...),
+state (on, off or flash), freq (flash frequency 1, 2, 4 or 8 Hz, default 2),
+duration (e.g. 500ms, default keeps state)
+*/
+func (s *server) outputHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	freq := 2
+	if f := q.Get("freq"); f != "" {
+		var err error
+		if freq, err = strconv.Atoi(f); err != nil {
+			http.Error(w, "Url Param 'freq' must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	var d time.Duration
+	if v := q.Get("duration"); v != "" {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "Url Param 'duration' must be a duration, e.g. 500ms", http.StatusBadRequest)
+			return
+		}
+	}
+	rec, err := newOutputRecord(q.Get("out"), q.Get("state"), freq, d, s.outputNames)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := setOutputs(s.Reader, rec); err != nil {
+		http.Error(w, "Error setting output: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
 func (s *server) handleStart(w http.ResponseWriter, r *http.Request) {
+	if err := s.ensureRF(); err != nil {
+		http.Error(w, "Error switching RF on: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 	s.mu.Lock()
 	s.mode = modeScan
 	s.mu.Unlock()
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDSFIDAndLocks(t *testing.T) {
+	r := newVirtualReader(2)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+	s.ReadTagsInRange()
+	id := "E0:04:01:50:00:00:00:01"
+
+	do := func(h func(*server, http.ResponseWriter, *http.Request), url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(s, w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+
+	if w := do((*server).writeDSFID, "/writeDSFID?value=0x3E"); w.Code != http.StatusOK {
+		t.Fatalf("Write DSFID failed: %d %s", w.Code, w.Body.String())
+	}
+	for _, tp := range r.sim.tags {
+		if tp.DSFID != 0x3E {
+			t.Errorf("Wrong DSFID of tag: 0x%02X", tp.DSFID)
+		}
+	}
+	if tag := s.inventory[id]; tag.Dfsid != 0x3E || tag.SystemInfo.DSFID != 0x3E {
+		t.Errorf("DSFID not updated in inventory: %#v", tag)
+	}
+
+	// locks need confirmation
+	if w := do((*server).lockAFI, "/lockAFI?tagid="+id); w.Code != http.StatusBadRequest || r.sim.tags[0].AFILocked {
+		t.Fatalf("Expected lock without confirmation refused, got %d", w.Code)
+	}
+	if w := do((*server).lockAFI, "/lockAFI?confirm=yes&tagid="+id); w.Code != http.StatusOK {
+		t.Fatalf("Lock AFI failed: %d %s", w.Code, w.Body.String())
+	}
+	if !r.sim.tags[0].AFILocked || r.sim.tags[1].AFILocked {
+		t.Errorf("Expected AFI locked of given tag only")
+	}
+	if w := do((*server).alarmOff, "/alarmOff"); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected alarm of tag with locked AFI to fail, got %d", w.Code)
+	}
+
+	if w := do((*server).lockDSFID, "/lockDSFID?confirm=yes"); w.Code != http.StatusOK {
+		t.Fatalf("Lock DSFID failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := do((*server).writeDSFID, "/writeDSFID?value=0x00&tagid="+id); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected write of locked DSFID to fail, got %d", w.Code)
+	}
+	if w := do((*server).lockDSFID, "/lockDSFID?confirm=yes&tagid=E0:00"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected tag not in range refused, got %d", w.Code)
+	}
+}
+
+func TestLockBlocks(t *testing.T) {
+	r := newVirtualReader(2)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+	r.sim.tags[1].BlockLocked[7] = true
+	s.ReadTagsInRange()
+	id := "E0:04:01:50:00:00:00:01"
+
+	do := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.lockBlocks(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+
+	if tag := s.inventory["E0:04:01:50:00:00:00:02"]; !reflect.DeepEqual(tag.LockedBlocks, []int{7}) {
+		t.Errorf("Wrong locked blocks read with content: %v", tag.LockedBlocks)
+	}
+	if w := do("/lockBlocks?tagid=" + id); w.Code != http.StatusBadRequest || r.sim.tags[0].BlockLocked[0] {
+		t.Fatalf("Expected lock without confirmation refused, got %d", w.Code)
+	}
+	if w := do("/lockBlocks?count=0&confirm=yes"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected zero blocks refused, got %d", w.Code)
+	}
+	// past end of tag memory, or no data model blocks left after start, nothing locked
+	if w := do("/lockBlocks?confirm=yes&start=60&count=8"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected blocks past end of tag refused, got %d", w.Code)
+	}
+	if w := do("/lockBlocks?confirm=yes&start=8&tagid=" + id); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected start after data model refused, got %d", w.Code)
+	}
+	for _, tp := range r.sim.tags {
+		for i, l := range tp.BlockLocked {
+			if l && i != 7 {
+				t.Fatalf("Expected nothing locked on refused request, block %d of tag % X", i, tp.UID)
+			}
+		}
+	}
+
+	// barcode and ISIL region only
+	if w := do("/lockBlocks?confirm=yes&start=0&count=5&tagid=" + id); w.Code != http.StatusOK {
+		t.Fatalf("Lock blocks failed: %d %s", w.Code, w.Body.String())
+	}
+	for i, l := range r.sim.tags[0].BlockLocked {
+		if l != (i < 5) {
+			t.Errorf("Wrong lock status of block %d: %v", i, l)
+		}
+	}
+	if tag := s.inventory[id]; !reflect.DeepEqual(tag.LockedBlocks, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("Locked blocks not updated in inventory: %v", tag.LockedBlocks)
+	}
+	if _, err := s.WriteTagBarcode(id, "03010000009999"); !errors.Is(err, ErrBlockLocked) {
+		t.Errorf("Expected write to locked blocks refused, got: %v", err)
+	}
+
+	// default all blocks of data model
+	if w := do("/lockBlocks?confirm=yes&tagid=E0:04:01:50:00:00:00:02"); w.Code != http.StatusOK {
+		t.Fatalf("Lock blocks failed: %d %s", w.Code, w.Body.String())
+	}
+	if tag := s.inventory["E0:04:01:50:00:00:00:02"]; len(tag.LockedBlocks) != 8 {
+		t.Errorf("Expected data model blocks locked, got: %v", tag.LockedBlocks)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hub keeps a server per connected reader and fans their events out to the event stream client
+type hub struct {
+	servers    []*server
+	Log        Logger
+	mu         sync.Mutex
+	client     chan EsMsg
+	register   chan (chan EsMsg)
+	unregister chan (chan EsMsg)
+	broadcast  chan EsMsg
+}
+
+func newHub(lgr Logger) *hub {
+	return &hub{
+		Log:        lgr,
+		client:     make(chan EsMsg), // dummy client to safely close on register/unregister
+		register:   make(chan (chan EsMsg)),
+		unregister: make(chan (chan EsMsg)),
+		broadcast:  make(chan EsMsg),
+	}
+}
+
+// add server of a reader, events are sent to hub and reader gets a unique id
+func (h *hub) add(s *server) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s.Id = h.uniqueId(readerId(s.Reader, len(h.servers)))
+	s.broadcast = h.broadcast
+	h.servers = append(h.servers, s)
+}
+
+// reader id is the device serial, or name (e.g. host:port) if serial is unknown
+func readerId(d Device, i int) string {
+	info := d.Info()
+	if info.Serial != "" {
+		return info.Serial
+	}
+	if info.Name != "" {
+		return info.Name
+	}
+	return strconv.Itoa(i)
+}
+
+func (h *hub) uniqueId(id string) string {
+	uid := id
+	for i := 2; h.find(uid) != nil; i++ {
+		uid = fmt.Sprintf("%s-%d", id, i)
+	}
+	return uid
+}
+
+func (h *hub) find(id string) *server {
+	for _, s := range h.servers {
+		if s.Id == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// first reader, used by the routes without reader id
+func (h *hub) defaultServer() *server {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.servers[0]
+}
+
+// start a scan loop per reader and pass events on to client
+func (h *hub) run() {
+	h.mu.Lock()
+	for _, s := range h.servers {
+		go s.readRFID()
+	}
+	h.mu.Unlock()
+	h.dispatch()
+}
+
+func (h *hub) dispatch() {
+	defer func() {
+		if err := recover(); err != nil {
+			if strings.Contains(fmt.Sprintf("%v", err), "close of closed channel") {
+				h.mu.Lock()
+				h.client = make(chan EsMsg)
+				h.mu.Unlock()
+				h.dispatch()
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-h.broadcast:
+			select {
+			case h.client <- msg:
+			case <-time.After(300 * time.Millisecond):
+				// drop it if noone respons after 1 sec
+			}
+		case c := <-h.register:
+			// clear inventories, new client gets all tags in range as new events
+			h.mu.Lock()
+			for _, s := range h.servers {
+				s.mu.Lock()
+				s.inventory = make(map[string]Tag, 0)
+				s.mu.Unlock()
+			}
+			h.mu.Unlock()
+
+			close(h.client)
+
+			h.mu.Lock()
+			h.client = c
+			h.mu.Unlock()
+		case c := <-h.unregister:
+			close(c)
+			h.mu.Lock()
+			h.client = make(chan EsMsg) // dummy client we can close on register
+			h.mu.Unlock()
+		}
+	}
+}
+
+// request handler for event source stream, events of all readers
+func (h *hub) esHandler(w http.ResponseWriter, r *http.Request) {
+	// Limit to 1 synchronous client
+	defer func() { <-semaphore }()
+	select {
+	case semaphore <- struct{}{}:
+	case <-time.After(2 * time.Second):
+		http.Error(w, "Busy, only tab at a time please!", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Make sure that the writer supports flushing.
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+		return
+	}
+
+	// Create a new channel for messages
+	msgChan := make(chan EsMsg)
+	h.register <- msgChan
+
+	// request context done? client disconnected, so unregister
+	notify := r.Context().Done()
+	go func() {
+		<-notify
+		h.unregister <- msgChan
+		log.Println("HTTP connection just closed.")
+	}()
+
+	// EventStream headers
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	for msg := range msgChan {
+
+		// Write to the ResponseWriter, `w`.
+		fmt.Fprintf(w, "event: %s\n", msg.Event)
+		fmt.Fprintf(w, "data: %s\n\n", msg.Data)
+
+		// Flush the response.  This is only possible if the repsonse supports streaming.
+		f.Flush()
+	}
+
+	log.Println("Finished HTTP request at ", r.URL.Path)
+}
+
+/*
+readersHandler serves /readers with status of all readers,
+and /readers/{id}/{route} with the reader routes (see readerRoutes) for a single reader
+*/
+func (h *hub) readersHandler(w http.ResponseWriter, r *http.Request) {
+	p := strings.Trim(strings.TrimPrefix(r.URL.Path, "/readers"), "/")
+	if p == "" {
+		h.mu.Lock()
+		status := make([]*ServerStatus, 0, len(h.servers))
+		for _, s := range h.servers {
+			s.mu.Lock()
+			status = append(status, s.ServerStatus())
+			s.mu.Unlock()
+		}
+		h.mu.Unlock()
+		b, err := json.Marshal(status)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+		return
+	}
+
+	id, route, _ := strings.Cut(p, "/")
+	h.mu.Lock()
+	s := h.find(id)
+	h.mu.Unlock()
+	if s == nil {
+		http.Error(w, fmt.Sprintf("Unknown reader '%s'", id), http.StatusNotFound)
+		return
+	}
+	handle, ok := readerRoutes["/"+route]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	handle(s, w, r)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadersHandler(t *testing.T) {
+	h := newHub(Logger{})
+	r1, r2 := newVirtualReader(1), newVirtualReader(2)
+	defer r1.Close()
+	defer r2.Close()
+	h.add(newServer(r1, true, Logger{}, "02030000"))
+	h.add(newServer(r2, true, Logger{}, "02030000"))
+
+	rec := httptest.NewRecorder()
+	h.readersHandler(rec, httptest.NewRequest("GET", "/readers", nil))
+	var status []struct{ Id string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Bad readers response: %v", err)
+	}
+	if len(status) != 2 || status[0].Id == status[1].Id {
+		t.Fatalf("Expected two readers with unique ids, got: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.readersHandler(rec, httptest.NewRequest("GET", "/readers/"+status[1].Id+"/scan", nil))
+	var tags map[string]Tag
+	if err := json.Unmarshal(rec.Body.Bytes(), &tags); err != nil {
+		t.Fatalf("Bad scan response: %v", err)
+	}
+	if len(tags) != 2 {
+		t.Errorf("Wrong number of tags from second reader: %d", len(tags))
+	}
+	for _, tag := range tags {
+		if tag.Reader != status[1].Id {
+			t.Errorf("Wrong reader id on tag: %s", tag.Reader)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.readersHandler(rec, httptest.NewRequest("GET", "/readers/nosuchreader/scan", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected not found for unknown reader, got: %d", rec.Code)
+	}
+}
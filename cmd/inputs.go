@@ -0,0 +1,100 @@
+package main
+
+/*
+ * Digital inputs of reader (CMD_GET_INPUT, 0x74), e.g. light barriers and door switches
+ *
+ * request:  -
+ * response: INP-STATE, bit 0 is input 1, set when active
+ *
+ * Inputs are polled by the scan loop, changes are sent as inputChanged events.
+ * Inputs in server.inputTrigger read inventory once when they become active.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// InputEvent is sent with inputChanged events
+type InputEvent struct {
+	Reader string
+	Input  int // from 1
+	Active bool
+}
+
+// read state of digital inputs
+func getInputs(d Device) (byte, error) {
+	status, data, err := d.Command(CMD_GET_INPUT, nil)
+	if err != nil {
+		return 0, err
+	}
+	if status != STATUS_OK {
+		return 0, &StatusError{Cmd: CMD_GET_INPUT, Status: status}
+	}
+	if len(data) < 1 {
+		return 0, errors.New("INPUT: Not enough bytes")
+	}
+	return data[0], nil
+}
+
+// mask of comma separated input numbers, e.g. 1,3 is 0x05
+func parseInputs(s string) (byte, error) {
+	var mask byte
+	for _, in := range strings.Split(s, ",") {
+		in = strings.TrimSpace(in)
+		if in == "" {
+			continue
+		}
+		n, err := strconv.Atoi(in)
+		if err != nil || n < 1 || n > 8 {
+			return 0, fmt.Errorf("invalid input number '%s', must be 1-8", in)
+		}
+		mask |= 1 << (n - 1)
+	}
+	return mask, nil
+}
+
+// poll inputs, send an event for each input changed, and read inventory if a trigger input became active
+func (s *server) checkInputs() {
+	s.mu.Lock()
+	poll := s.pollInputs && s.conn == connConnected
+	s.mu.Unlock()
+	if !poll {
+		return
+	}
+	state, err := getInputs(s.Reader)
+	if err != nil {
+		var se *StatusError
+		if errors.As(err, &se) {
+			// reader has no inputs, don't try again
+			s.mu.Lock()
+			s.pollInputs = false
+			s.mu.Unlock()
+			s.Log.Printf("Could not read inputs, reader %s: %v", s.Id, err)
+		}
+		s.checkConnection(err)
+		return
+	}
+
+	s.mu.Lock()
+	prev, known := s.inputs, s.inputsKnown
+	s.inputs, s.inputsKnown = state, true
+	mode := s.mode
+	s.mu.Unlock()
+	if !known {
+		// no change on first read
+		prev = state
+	}
+	changed := state ^ prev
+	for i := 0; i < 8; i++ {
+		if changed&(1<<i) != 0 {
+			s.emit("inputChanged", InputEvent{Reader: s.Id, Input: i + 1, Active: state&(1<<i) != 0})
+		}
+	}
+	if changed&state&s.inputTrigger != 0 && mode != modeScan {
+		s.Log.Debugf("INPUT TRIGGER, reading inventory of reader %s", s.Id)
+		s.ReadTagsInRange()
+	}
+}
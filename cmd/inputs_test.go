@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestInputs(t *testing.T) {
+	r := newVirtualReader(1)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+	s.Id = "virtual"
+	s.pollInputs = true
+	s.inputTrigger = 0x02
+
+	s.checkInputs()
+	r.sim.mu.Lock()
+	r.sim.Inputs = 0x02
+	r.sim.mu.Unlock()
+	s.checkInputs()
+
+	// input 2 active, and inventory read once
+	events := map[string]EsMsg{}
+	for len(events) < 2 {
+		select {
+		case msg := <-s.broadcast:
+			events[msg.Event] = msg
+		case <-time.After(time.Second):
+			t.Fatalf("Expected inputChanged and addTag events, got: %v", events)
+		}
+	}
+	var ev InputEvent
+	if err := json.Unmarshal(events["inputChanged"].Data, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev != (InputEvent{Reader: "virtual", Input: 2, Active: true}) {
+		t.Errorf("Wrong inputChanged event: %+v", ev)
+	}
+	if _, ok := events["addTag"]; !ok {
+		t.Errorf("Expected addTag event on input trigger, got: %v", events)
+	}
+
+	s.checkInputs()
+	select {
+	case msg := <-s.broadcast:
+		t.Errorf("Expected no event without input change, got: %s %s", msg.Event, msg.Data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -17,13 +18,19 @@ type Inventory struct {
 	Tags   map[string]Tag
 }
 
-// Tags are exactly 10 bytes
+// Tag as seen in inventory, memory layout from system information or chip table, see memory.go
 type Tag struct {
-	Trtype  uint16 // transistor type (1 byte)
-	Dfsid   uint16 // Data Storage Family Identifier (1 byte)
-	Id      []byte // 8 bytes
-	Mac     string // string formatted ID (MAC)
-	Content TagContent
+	Trtype       uint16      // transistor type (1 byte)
+	Dfsid        uint16      // Data Storage Family Identifier (1 byte)
+	Id           []byte      // 8 bytes
+	Mac          string      // string formatted ID (MAC)
+	Reader       string      // id of reader the tag is in range of
+	Antenna      uint8       // antenna number (1-8) with the strongest signal, 0 if not known
+	SystemInfo   *SystemInfo // memory layout and identifiers, nil if not read
+	LockedBlocks []int       // write protected blocks of data model
+	EAS          *bool       // NXP EAS bit set, nil if not known
+	Genuine      *bool       // NXP originality signature verified, nil if not known
+	Content      TagContent
 }
 
 type TagContent struct {
@@ -66,7 +73,13 @@ func newTagContent(bs []byte) (TagContent, error) {
 	return tc, nil
 }
 
+// tag content in 4 byte blocks
 func (tc *TagContent) ToBytes() ([]byte, error) {
+	return tc.ToBlocks(4)
+}
+
+// tag content in blocks of blockSize bytes, as written to tag
+func (tc *TagContent) ToBlocks(blockSize int) ([]byte, error) {
 	bs := make([]byte, 36)
 	bs[0] = 0x11 // 17 (4bit version, 4bit type)
 	bs[1] = tc.NumItems
@@ -78,9 +91,9 @@ func (tc *TagContent) ToBytes() ([]byte, error) {
 	csum_bytes := make([]byte, 32)
 	copy(csum_bytes[0:19], bs[0:19])
 	copy(csum_bytes[19:32], bs[21:34])
-	crc := crc16(csum_bytes, CRCTable)
+	crc := crc16(csum_bytes, dataModelCRCTable)
 	copy(bs[19:21], crc)
-	wb, err := prepareWriteTagBytes(bs)
+	wb, err := prepareWriteTagBytes(bs, blockSize)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -95,25 +108,43 @@ func (inv *Inventory) Process(s *server) map[string]Tag {
 	for k := range inv.Tags {
 		knownIDs[k] = true
 		fmt.Printf("TAG ID %s\n", k)
-		if _, exists := s.inventory[k]; exists {
+		if t, exists := s.inventory[k]; exists {
 			fmt.Printf("TAG ALREADY READ: %s\n", k)
+			if a := inv.Tags[k].Antenna; a != 0 && a != t.Antenna {
+				// moved to another antenna
+				t.Antenna = a
+				s.mu.Lock()
+				s.inventory[k] = t
+				s.emit("tagMoved", t)
+				s.mu.Unlock()
+			}
 		} else {
 			// Add to inventory, and read data
 			fmt.Printf("NEW TAG ADDED: %s\n", k)
 			tag := inv.Tags[k]
-			//s.Reader.GetSystemInformation(&tag)
-			d, err := s.Reader.ReadTagContent(&tag)
+			tag.Reader = s.Id
+			tag.SystemInfo = s.systemInfo(&tag)
+			s.security.readAlarm(s.Reader, &tag)
+			tag.Genuine = s.genuine(&tag)
+			var d []byte
+			err := s.withPasswords(tag, func() (err error) {
+				d, err = s.Reader.ReadTagContent(&tag)
+				return err
+			}, NXP_PWD_READ)
 			if err != nil {
 				if err.Error() != ErrResourceTempUnavailable.Error() {
 					fmt.Printf("ERROR READING TAG DATA: %v\n", err)
-					atomic.AddUint64(&s.Reader.ReadTagFail, 1)
+					atomic.AddUint64(&s.Reader.Stats().ReadTagFail, 1)
 				}
 			}
+			if _, locked, err := decodeBlocks(d); err == nil {
+				tag.LockedBlocks = lockedBlocks(0, locked)
+			}
 			tc, err := newTagContent(d)
 
 			if err != nil {
 				fmt.Printf("ERROR PROCESSING TAG DATA: %v\n", err)
-				atomic.AddUint64(&s.Reader.ReadTagFail, 1)
+				atomic.AddUint64(&s.Reader.Stats().ReadTagFail, 1)
 			} else {
 				/* manually strip last initial '10' or last two bytes
 				var bc []byte
@@ -127,7 +158,7 @@ func (inv *Inventory) Process(s *server) map[string]Tag {
 				s.mu.Lock()
 				s.inventory[k] = tag
 				s.mu.Unlock()
-				atomic.AddUint64(&s.Reader.ReadTagSucc, 1)
+				atomic.AddUint64(&s.Reader.Stats().ReadTagSucc, 1)
 			}
 
 			s.mu.Lock()
@@ -143,6 +174,7 @@ func (inv *Inventory) Process(s *server) map[string]Tag {
 			go func() {
 				s.broadcast <- msg
 			}()
+			s.signal("addTag")
 
 		}
 	}
@@ -164,6 +196,7 @@ func (inv *Inventory) Process(s *server) map[string]Tag {
 			go func() {
 				s.broadcast <- msg
 			}()
+			s.signal("removeTag")
 			delete(s.inventory, j)
 		}
 	}
@@ -172,20 +205,44 @@ func (inv *Inventory) Process(s *server) map[string]Tag {
 	return s.inventory
 }
 
+// inventory from response data: count, {trtype, dsfid, uid(8)}
 func getInventory(res []byte) (*Inventory, error) {
-	if len(res) < 10 {
-		return &Inventory{}, ErrInventoryEmpty
+	if len(res) < 11 {
+		return &Inventory{Tags: map[string]Tag{}}, ErrInventoryEmpty
 	}
-	// TODO: if status = 0x94 More data available - read more with mode = 0x01
-
 	tags := getTags(res[1:])
 	return &Inventory{
-		Status: respStatus[0x00], // fake this for now
-		Count:  uint16(res[0]),
+		Status: respStatus[STATUS_OK],
+		Count:  uint16(len(tags)),
+		Tags:   tags,
+	}, nil
+}
+
+// inventory from response data in antenna mode: count, {trtype, dsfid, uid(8), ant-cnt, {ant-nr, rssi}}
+func getAntennaInventory(res []byte) (*Inventory, error) {
+	if len(res) < 12 {
+		return &Inventory{Tags: map[string]Tag{}}, ErrInventoryEmpty
+	}
+	tags := getAntennaTags(res[1:])
+	return &Inventory{
+		Status: respStatus[STATUS_OK],
+		Count:  uint16(len(tags)),
 		Tags:   tags,
 	}, nil
 }
 
+// add tags from a follow-up inventory response (STATUS_MORE_DATA_AVAILABLE)
+func (inv *Inventory) merge(next *Inventory) {
+	if inv.Tags == nil {
+		inv.Tags = make(map[string]Tag, len(next.Tags))
+	}
+	for k, t := range next.Tags {
+		inv.Tags[k] = t
+	}
+	inv.Count = uint16(len(inv.Tags))
+	inv.Status = next.Status
+}
+
 func getTags(buf []byte) map[string]Tag {
 	// each tag is 10 bytes exactly: two status bytes and eight uid
 	lim := 10
@@ -205,47 +262,95 @@ func getTags(buf []byte) map[string]Tag {
 	return ts
 }
 
+// antenna records are 10 bytes as above, followed by antenna count and antenna number and RSSI per antenna
+func getAntennaTags(buf []byte) map[string]Tag {
+	ts := make(map[string]Tag, 0)
+	for len(buf) >= 11 {
+		n := 11 + 2*int(buf[10])
+		if len(buf) < n {
+			break
+		}
+		t := Tag{
+			Trtype: uint16(buf[0]),
+			Dfsid:  uint16(buf[1]),
+			Id:     buf[2:10],
+			Mac:    tagIDtoMAC(buf[2:10]),
+		}
+		var rssi byte
+		for ant := buf[11:n]; len(ant) >= 2; ant = ant[2:] {
+			if t.Antenna == 0 || ant[1] > rssi {
+				t.Antenna, rssi = ant[0], ant[1]
+			}
+		}
+		ts[t.Mac] = t
+		buf = buf[n:]
+	}
+	return ts
+}
+
+/*
+parse comma separated antenna numbers (1-8) to an ANT-SEL mask, e.g. "1,3" is 0x05
+empty string is 0, i.e. no antenna selection
+*/
+func parseAntennas(s string) (byte, error) {
+	var mask byte
+	for _, a := range strings.Split(s, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		n, err := strconv.Atoi(a)
+		if err != nil || n < 1 || n > 8 {
+			return 0, fmt.Errorf("invalid antenna number '%s', must be 1-8", a)
+		}
+		mask |= 1 << (n - 1)
+	}
+	return mask, nil
+}
+
 /*
 tag read content
 
-	process blocks of 5 bytes, (except first two and last, which are zero)
+	DB-N, DB-SIZE, then DB-N blocks of 1 + DB-SIZE bytes
 	1st is security byte
-	then 4 bytes reversed
+	then DB-SIZE bytes reversed
 */
 func prepareReadTagBytes(bs []byte) ([]byte, error) {
-	if len(bs) < 5 {
+	if len(bs) < 2 || bs[1] == 0 {
 		return nil, errors.New("prepareReadTagBytes: Not enough bytes")
 	}
-	lim := 5
+	n, lim := int(bs[0]), 1+int(bs[1])
 	var chunk []byte
-	blks := bs[2 : len(bs)-2]
+	blks := bs[2:]
 	data := make([]byte, 0)
-	for len(blks) >= lim {
+	for i := 0; i < n && len(blks) >= lim; i++ {
 		chunk, blks = blks[:lim], blks[lim:]
-		// Skip first byte (unused security byte) and reverse block (4bytes)
+		// Skip first byte (security byte) and reverse block
 		blk := reverseBytes(chunk[1:])
 		data = append(data, blk...)
 	}
+	if len(data) < dataModelSize {
+		return nil, fmt.Errorf("prepareReadTagBytes: %d bytes read, data model needs %d", len(data), dataModelSize)
+	}
 	return data, nil
 }
 
 /*
 prepare tag content for write
-content of 4 byte blocks reversed
-and added security byte
+content in blocks of blockSize bytes reversed, last block padded with zeros
 */
-func prepareWriteTagBytes(tc []byte) ([]byte, error) {
-	if len(tc) < 4 {
+func prepareWriteTagBytes(tc []byte, blockSize int) ([]byte, error) {
+	if len(tc) < blockSize || blockSize < 1 {
 		return nil, errors.New("prepareWriteBytes: Not enough bytes")
 	}
+	if r := len(tc) % blockSize; r != 0 {
+		tc = append(tc, make([]byte, blockSize-r)...)
+	}
 	data := make([]byte, 0)
-	for i := 0; i <= len(tc)-4; i += 4 {
-		blk := reverseBytes(tc[i : i+4])
-		//data = append(data, 0x00) // security byte
+	for i := 0; i <= len(tc)-blockSize; i += blockSize {
+		blk := reverseBytes(tc[i : i+blockSize])
 		data = append(data, blk...)
 	}
-	//data = append([]byte{0x00, 0x00}, data...)
-	//data = append(data, []byte{0x00, 0x00}...)
 	return data, nil
 }
 
@@ -275,38 +380,62 @@ func btou16(b []byte) uint16 {
 }
 
 /*
-CRC16 implementation
-using CCITT reversed algorithm
+CRC16 implementation, table driven, preset 0xFFFF, result LSB first
+reflected: CCITT reversed algorithm (0x8408) of host protocol frames
+otherwise: CCITT (0x1021) of the data model
 ripped from github.com/howeyc/crc16 for performance
 */
-func makeCRCTable() [256]uint16 {
-	var tbl [256]uint16
-	width := uint16(16)
+type crcTable struct {
+	tbl       [256]uint16
+	reflected bool
+}
+
+var (
+	CRCTable          = makeCRCTable(CCITT_FORWARD, true)   // CRC CCITT reversed table for fast lookup, host protocol frames
+	dataModelCRCTable = makeCRCTable(CCITT_REVERSED, false) // CRC of tag content
+)
+
+func makeCRCTable(poly uint16, reflected bool) crcTable {
+	t := crcTable{reflected: reflected}
 	for i := uint16(0); i < 256; i++ {
-		crc := i << (width - 8)
-		for j := 0; j < 8; j++ {
-			if crc&(1<<(width-1)) != 0 {
-				crc = (crc << 1) ^ CCITT_REVERSED
-			} else {
-				crc <<= 1
+		var crc uint16
+		if reflected {
+			crc = i
+			for j := 0; j < 8; j++ {
+				if crc&0x0001 != 0 {
+					crc = (crc >> 1) ^ poly
+				} else {
+					crc >>= 1
+				}
+			}
+		} else {
+			crc = i << 8
+			for j := 0; j < 8; j++ {
+				if crc&0x8000 != 0 {
+					crc = (crc << 1) ^ poly
+				} else {
+					crc <<= 1
+				}
 			}
 		}
-		tbl[i] = crc
+		t.tbl[i] = crc
 	}
-	return tbl
+	return t
 }
 
-func crc16(b []byte, tbl [256]uint16) []byte {
+func crc16(b []byte, t crcTable) []byte {
 	crc := uint16(0xFFFF)
 	for _, v := range b {
-		crc = tbl[byte(crc>>8)^v] ^ (crc << 8)
+		if t.reflected {
+			crc = t.tbl[byte(crc)^v] ^ (crc >> 8)
+		} else {
+			crc = t.tbl[byte(crc>>8)^v] ^ (crc << 8)
+		}
 	}
-	msb := crc & 0x00FF
-	lsb := crc >> 8
-	return []byte{uint8(msb), uint8(lsb)}
+	return []byte{uint8(crc & 0x00FF), uint8(crc >> 8)}
 }
 
-// compare computed CRC with last two bytes of response - not used
+// compare computed CRC with last two bytes of protocol frame
 func validateCRC(b []byte) bool {
 	if len(b) < 4 {
 		return false
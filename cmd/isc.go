@@ -0,0 +1,555 @@
+package main
+
+/*
+ * FEIG ISC host protocol, native implementation (no FEISC/FETCP needed)
+ * Uses the advanced protocol frame, as set by FrameSupport=Advanced in newReader
+ *
+ * request:
+ * STX LENGTH(2) ADDR CMD [DATA...] CRC16(2)
+ *
+ * response:
+ * STX LENGTH(2) ADDR CMD STATUS [DATA...] CRC16(2)
+ *
+ * LENGTH is the full frame length including STX and CRC
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	iscDialTimeout = 5 * time.Second
+	iscTimeout     = 2 * time.Second
+
+	maxInventoryReads = 64 // follow-up reads on STATUS_MORE_DATA_AVAILABLE, guards against a reader never finishing (ErrInventoryTruncated)
+)
+
+var (
+	ErrNotConnected error = errors.New("reader not connected")
+	ErrFrame        error = errors.New("invalid protocol frame")
+	ErrCRC          error = errors.New("CRC error in protocol frame")
+	ErrTimeout      error = errors.New("timeout waiting for reader response")
+)
+
+// StatusError is returned when the reader answers a command with an error status byte
+type StatusError struct {
+	Cmd      byte
+	Status   byte
+	TagError byte // ISO15693 error code with STATUS_TAG_ERROR
+}
+
+// status error of response, with ISO15693 error code from data if the tag answered with an error
+func newStatusError(cmd, status byte, data []byte) *StatusError {
+	e := &StatusError{Cmd: cmd, Status: status}
+	if status == STATUS_TAG_ERROR && len(data) > 0 {
+		e.TagError = data[0]
+	}
+	return e
+}
+
+func (e *StatusError) Error() string {
+	if e.TagError != 0 {
+		return fmt.Sprintf("command 0x%02X failed with status 0x%02X: %s, ISO15693 error 0x%02X", e.Cmd, e.Status, respStatus[e.Status], e.TagError)
+	}
+	return fmt.Sprintf("command 0x%02X failed with status 0x%02X: %s", e.Cmd, e.Status, respStatus[e.Status])
+}
+
+// frame is a decoded response from the reader
+type frame struct {
+	Addr   byte
+	Cmd    byte
+	Status byte
+	Data   []byte
+}
+
+// Full cmd is STX + LENGTH + ADDR + CMD + DATA + CRC16
+func encodeFrame(addr byte, cmd []byte) []byte {
+	msglen := 6 + len(cmd) // STX + LENGTH + ADDR + CRC = 6
+	tx := make([]byte, 0, msglen)
+	tx = append(tx, STX)
+	tx = append(tx, u16tob(uint16(msglen))...)
+	tx = append(tx, addr)
+	tx = append(tx, cmd...)
+	tx = append(tx, crc16(tx, CRCTable)...)
+	return tx
+}
+
+// decode a complete response frame
+func decodeFrame(b []byte) (*frame, error) {
+	if len(b) < 8 || b[0] != STX || int(btou16(b[1:3])) != len(b) {
+		return nil, ErrFrame
+	}
+	return &frame{
+		Addr:   b[3],
+		Cmd:    b[4],
+		Status: b[5],
+		Data:   b[6 : len(b)-2],
+	}, nil
+}
+
+// frameReader reads protocol frames from a stream, resynchronising on STX
+type frameReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+func newFrameReader(r io.Reader) *frameReader {
+	return &frameReader{r: r}
+}
+
+/*
+ReadFrame reads a single frame, using length from header
+Bytes before STX are skipped, and frames failing CRC are discarded by
+searching for the next STX. Gives up after deadline, zero deadline waits forever.
+Empty reads (e.g. serial read timeouts) are retried until deadline
+*/
+func (fr *frameReader) ReadFrame(deadline time.Time) ([]byte, error) {
+	chunk := make([]byte, 256)
+	crcFailed := false
+	for {
+		if i := bytes.IndexByte(fr.buf, STX); i < 0 {
+			fr.buf = fr.buf[:0]
+		} else {
+			fr.buf = fr.buf[i:]
+		}
+		if len(fr.buf) >= 3 {
+			l := int(btou16(fr.buf[1:3]))
+			if l < 7 { // shortest request: STX LENGTH(2) ADDR CMD CRC16(2)
+				fr.buf = fr.buf[1:]
+				continue
+			}
+			if len(fr.buf) >= l {
+				if validateCRC(fr.buf[:l]) {
+					b := make([]byte, l)
+					copy(b, fr.buf)
+					fr.buf = fr.buf[l:]
+					return b, nil
+				}
+				crcFailed = true
+				fr.buf = fr.buf[1:]
+				continue
+			}
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			if crcFailed {
+				return nil, ErrCRC
+			}
+			return nil, ErrTimeout
+		}
+		n, err := fr.r.Read(chunk)
+		fr.buf = append(fr.buf, chunk[:n]...)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return nil, fmt.Errorf("%w: %v", ErrTimeout, err)
+			}
+			return nil, err
+		}
+	}
+}
+
+// ISCReader is a FEIG reader connected over a stream (e.g. TCP), speaking the host protocol natively
+type ISCReader struct {
+	Name     string
+	Family   string
+	Serial   string
+	Address  byte
+	Antennas byte // ANT-SEL mask for inventory, 0 uses the antennas configured in reader
+	Counters
+	conn    io.ReadWriteCloser
+	fr      *frameReader                       // reads responses from conn, kept for the life of conn
+	dial    func() (io.ReadWriteCloser, error) // opens conn again on Reconnect
+	timeout time.Duration
+	mu      sync.Mutex
+}
+
+func newISCReader(conn io.ReadWriteCloser) *ISCReader {
+	r := &ISCReader{
+		Family:  "OBID i-scan",
+		Address: BCAST,
+		timeout: iscTimeout,
+	}
+	r.setConn(conn)
+	return r
+}
+
+// r.mu must be held, or r not yet shared
+func (r *ISCReader) setConn(conn io.ReadWriteCloser) {
+	r.conn = conn
+	r.fr = nil
+	if conn != nil {
+		r.fr = newFrameReader(conn)
+	}
+}
+
+// connect to a network reader, e.g. a FEIG Axe, at host:port
+func dialISC(addr string) (*ISCReader, error) {
+	r := newISCReader(nil)
+	r.Name = addr
+	r.dial = func() (io.ReadWriteCloser, error) {
+		return net.DialTimeout("tcp", addr, iscDialTimeout)
+	}
+	conn, err := r.dial()
+	if err != nil {
+		return r, err
+	}
+	r.setConn(conn)
+	return r, nil
+}
+
+// close connection and open it again
+func (r *ISCReader) Reconnect() error {
+	if r.dial == nil {
+		return errors.New("reconnect not supported")
+	}
+	r.Close()
+	conn, err := r.dial()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.setConn(conn)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *ISCReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.setConn(nil)
+	return err
+}
+
+/*
+Command sends cmd with data to reader and returns response status and data
+Input left from earlier requests is discarded before sending, and responses to
+other commands arriving late (e.g. after a timeout) are skipped until deadline
+*/
+func (r *ISCReader) Command(cmd byte, data []byte) (byte, []byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return 0, nil, ErrNotConnected
+	}
+	deadline := time.Now().Add(r.timeout)
+	if c, ok := r.conn.(net.Conn); ok {
+		c.SetDeadline(deadline)
+	}
+
+	r.fr.buf = r.fr.buf[:0]
+	tx := encodeFrame(r.Address, append([]byte{cmd}, data...))
+	if _, err := r.conn.Write(tx); err != nil {
+		return 0, nil, err
+	}
+	for {
+		b, err := r.fr.ReadFrame(deadline)
+		if err != nil {
+			return 0, nil, err
+		}
+		f, err := decodeFrame(b)
+		if err != nil {
+			return 0, nil, err
+		}
+		if f.Cmd != cmd {
+			continue // stale response to an earlier request
+		}
+		return f.Status, f.Data, nil
+	}
+}
+
+func (r *ISCReader) Info() DeviceInfo {
+	return DeviceInfo{Name: r.Name, Family: r.Family, Serial: r.Serial}
+}
+
+func (r *ISCReader) Stats() *Counters {
+	return &r.Counters
+}
+
+func (r *ISCReader) SetAntennas(ants byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Antennas = ants
+}
+
+/*
+ReadInventory reads all tags in field
+If the reader has more data sets than fit in one response it answers
+STATUS_MORE_DATA_AVAILABLE, and the rest is read with the MORE mode bit set
+*/
+func (r *ISCReader) ReadInventory() (*Inventory, error) {
+	inv := &Inventory{Tags: map[string]Tag{}}
+	req := []byte{ISO15693_INVENTORY, 0x00}
+	r.mu.Lock()
+	ant := r.Antennas
+	r.mu.Unlock()
+	if ant != 0 {
+		req = []byte{ISO15693_INVENTORY, ISO15693_MODE_ANT, ant}
+	}
+	for i := 0; i < maxInventoryReads; i++ {
+		status, d, err := r.Command(CMD_ISO15693, req)
+		if err != nil {
+			return inv, err
+		}
+		next, err := getResponseInventory(status, d, req[1]&ISO15693_MODE_ANT != 0)
+		if i == 0 && err != nil {
+			return next, err
+		}
+		if err == ErrInventoryEmpty {
+			// nothing left after previous data sets
+			return inv, nil
+		}
+		inv.merge(next)
+		if err != nil {
+			return inv, err
+		}
+		if status != STATUS_MORE_DATA_AVAILABLE {
+			return inv, nil
+		}
+		req[1] |= ISO15693_MODE_MORE
+	}
+	return inv, ErrInventoryTruncated
+}
+
+// inventory from response status and data, with antenna records if requested in antenna mode
+func getResponseInventory(status byte, d []byte, ant bool) (*Inventory, error) {
+	switch status {
+	case STATUS_OK, STATUS_RF_COMMUNICATION_ERROR, STATUS_RF_WARNING, STATUS_MORE_DATA_AVAILABLE:
+		// data sets might still be present
+	case STATUS_NO_TRANSPONDER:
+		return &Inventory{Status: respStatus[status]}, ErrInventoryEmpty
+	default:
+		return &Inventory{Status: respStatus[status]}, &StatusError{Cmd: CMD_ISO15693, Status: status}
+	}
+	parse := getInventory
+	if ant {
+		parse = getAntennaInventory
+	}
+	inv, err := parse(d)
+	inv.Status = respStatus[status]
+	return inv, err
+}
+
+func (r *ISCReader) ReadTagContent(t *Tag) ([]byte, error) {
+	n, err := tagLayout(t).dataBlocks()
+	if err != nil {
+		return nil, err
+	}
+	req := []byte{ISO15693_READ_BYTES, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, 0x00, byte(n)) // start block, blocks of data model
+	status, d, err := r.Command(CMD_ISO15693, req)
+	if err != nil {
+		return nil, err
+	}
+	if status != STATUS_OK {
+		return nil, newStatusError(CMD_ISO15693, status, d)
+	}
+	return d, nil
+}
+
+func (r *ISCReader) WriteTagContent(t Tag) ([]byte, error) {
+	if err := writeContent(r, &t); err != nil {
+		atomic.AddUint64(&r.WriteTagFail, 1)
+		return []byte{}, err
+	}
+	atomic.AddUint64(&r.WriteTagSucc, 1)
+	return []byte{}, nil
+}
+
+func (r *ISCReader) readBlocks(t *Tag, start, n int) ([]byte, []bool, error) {
+	req := []byte{ISO15693_READ_BYTES, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, byte(start), byte(n))
+	status, d, err := r.Command(CMD_ISO15693, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != STATUS_OK {
+		return nil, nil, newStatusError(CMD_ISO15693, status, d)
+	}
+	return decodeBlocks(d)
+}
+
+func (r *ISCReader) writeBlocks(t *Tag, start, n, size int, data []byte) error {
+	req := []byte{ISO15693_WRITE_BYTES, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, byte(start), byte(n), byte(size)) // DB-ADR, DB-N, DB-SIZE
+	req = append(req, data...)
+
+	/* Retry 5 times on timeout or give up */
+	for i := 0; i < 5; i++ {
+		status, d, err := r.Command(CMD_ISO15693, req)
+		if isTimeout(err) {
+			time.Sleep(time.Millisecond * 100)
+			continue
+		}
+		if err == nil && status != STATUS_OK {
+			err = newStatusError(CMD_ISO15693, status, d)
+		}
+		return err
+	}
+	return errors.New("Timeout waiting for RFID")
+}
+
+func (r *ISCReader) writeBlock(t *Tag, block, size int, data []byte) error {
+	req := []byte{ISO15693_WRITE_BLOCK, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, byte(block), byte(size)) // DB-ADR, DB-SIZE
+	req = append(req, data...)
+	status, d, err := r.Command(CMD_ISO15693, req)
+	if err == nil && status != STATUS_OK {
+		err = newStatusError(CMD_ISO15693, status, d)
+	}
+	return err
+}
+
+func (r *ISCReader) WriteAFIByte(t Tag, afi byte) error {
+	req := []byte{ISO15693_WRITE_AFI, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, afi)
+
+	var err error
+	// Retry 5 times on timeout or give up, a status is the definitive answer of the tag
+	for i := 0; i <= 5; i++ {
+		var status byte
+		var d []byte
+		status, d, err = r.Command(CMD_ISO15693, req)
+		if err == nil && status != STATUS_OK {
+			err = newStatusError(CMD_ISO15693, status, d)
+		}
+		if !isTimeout(err) {
+			break
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	if err != nil {
+		atomic.AddUint64(&r.WriteAFIFail, 1)
+		return err
+	}
+	atomic.AddUint64(&r.WriteAFISucc, 1)
+	return nil
+}
+
+func (r *ISCReader) GetSystemInformation(t *Tag) (*SystemInfo, error) {
+	req := []byte{ISO15693_SYSINFO, 0x01}
+	req = append(req, t.Id...)
+	status, d, err := r.Command(CMD_ISO15693, req)
+	if err != nil {
+		return nil, err
+	}
+	if status != STATUS_OK {
+		return nil, newStatusError(CMD_ISO15693, status, d)
+	}
+	return decodeSystemInfo(d)
+}
+
+func (r *ISCReader) WriteDSFID(t Tag, dsfid byte) error {
+	return r.tagCommand(ISO15693_WRITE_DSFID, t, dsfid)
+}
+
+func (r *ISCReader) LockAFI(t Tag) error {
+	return r.tagCommand(ISO15693_LOCK_AFI, t)
+}
+
+func (r *ISCReader) LockDSFID(t Tag) error {
+	return r.tagCommand(ISO15693_LOCK_DSFID, t)
+}
+
+func (r *ISCReader) LockBlocks(t Tag, start, n int) error {
+	return r.tagCommand(ISO15693_LOCK_BLOCKS, t, byte(start), byte(n))
+}
+
+func (r *ISCReader) SetEAS(t Tag, on bool) error {
+	cmd := byte(NXP_RESET_EAS)
+	if on {
+		cmd = NXP_SET_EAS
+	}
+	_, err := r.nxpCommand(cmd, t)
+	return err
+}
+
+func (r *ISCReader) SetPassword(t Tag, id byte, pwd []byte) error {
+	return setPassword(r, t, id, pwd)
+}
+
+func (r *ISCReader) WritePassword(t Tag, id byte, pwd []byte) error {
+	return writePassword(r, t, id, pwd)
+}
+
+func (r *ISCReader) EnablePrivacy(t Tag, pwd []byte) error {
+	return enablePrivacy(r, t, pwd)
+}
+
+func (r *ISCReader) ProtectPage(t Tag, pointer, condition byte) error {
+	_, err := r.nxpCommand(NXP_PROTECT_PAGE, t, pointer, condition)
+	return err
+}
+
+func (r *ISCReader) ReadSignature(t Tag) ([]byte, error) {
+	return r.nxpCommand(NXP_READ_SIGNATURE, t)
+}
+
+func (r *ISCReader) LockEAS(t Tag) error {
+	_, err := r.nxpCommand(NXP_LOCK_EAS, t)
+	return err
+}
+
+// tags without EAS set do not answer EAS Alarm
+func (r *ISCReader) EASAlarm(t Tag) (bool, error) {
+	_, err := r.nxpCommand(NXP_EAS_ALARM, t)
+	var se *StatusError
+	if errors.As(err, &se) && se.Status == STATUS_NO_TRANSPONDER {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// NXP custom command to tag in addressed mode
+func (r *ISCReader) nxpCommand(cmd byte, t Tag, params ...byte) ([]byte, error) {
+	// non-addressed for tag without UID, e.g. in privacy mode
+	mode := byte(0x01)
+	if len(t.Id) == 0 {
+		mode = 0x00
+	}
+	req := []byte{MFR_NXP, cmd, mode}
+	req = append(req, t.Id...)
+	req = append(req, params...)
+	status, d, err := r.Command(CMD_ISO15693_CUSTOM, req)
+	if err == nil && status != STATUS_OK {
+		err = newStatusError(CMD_ISO15693_CUSTOM, status, d)
+	}
+	return d, err
+}
+
+// ISO15693 command to tag in addressed mode, without response data
+func (r *ISCReader) tagCommand(sub byte, t Tag, params ...byte) error {
+	req := []byte{sub, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, params...)
+	status, d, err := r.Command(CMD_ISO15693, req)
+	if err == nil && status != STATUS_OK {
+		err = newStatusError(CMD_ISO15693, status, d)
+	}
+	return err
+}
+
+func (r *ISCReader) ResetToReady() error {
+	_, _, err := r.Command(CMD_ISO15693, []byte{ISO15693_RESET_TO_READY, 0x00})
+	return err
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, ErrTimeout)
+}
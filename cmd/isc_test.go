@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEncodeFrame(t *testing.T) {
+	want := []byte{STX, 0x00, 0x08, 0xFF, CMD_BAUDRATE, 0x00, 0x4A, 0xC3}
+	got := encodeFrame(BCAST, []byte{CMD_BAUDRATE, 0x00})
+	if !bytes.Equal(got, want) {
+		t.Errorf("Wrong frame:\ngot:  % 02X\nwant: % 02X\n", got, want)
+	}
+}
+
+func TestValidateCRC(t *testing.T) {
+	f := encodeFrame(0x00, []byte{CMD_SW_VERSION, STATUS_OK, 0x02, 0x06})
+	if !validateCRC(f) {
+		t.Errorf("Expected CRC of encoded frame valid: % 02X", f)
+	}
+	f[len(f)-1] ^= 0xFF
+	if validateCRC(f) {
+		t.Errorf("Expected corrupted CRC invalid: % 02X", f)
+	}
+	if validateCRC([]byte{STX, 0x00}) {
+		t.Errorf("Expected too short frame invalid")
+	}
+}
+
+func TestISCReaderInventory(t *testing.T) {
+	client, peer := net.Pipe()
+	defer client.Close()
+	defer peer.Close()
+
+	res := []byte{0x02, 0x00, 0x1D, 0x00, 0xB0, 0x00, 0x02,
+		0x03, 0x00, 0xE0, 0x04, 0x01, 0x50, 0x33, 0x09, 0xCE, 0x74,
+		0x03, 0x00, 0xE0, 0x04, 0x01, 0x00, 0x46, 0x70, 0x7A, 0x28}
+	res = append(res, crc16(res, CRCTable)...)
+
+	go func() {
+		req, err := newFrameReader(peer).ReadFrame(time.Time{})
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(req, encodeFrame(BCAST, []byte{CMD_ISO15693, ISO15693_INVENTORY, 0x00})) {
+			t.Errorf("Wrong inventory request: % 02X", req)
+		}
+		peer.Write(res)
+	}()
+
+	r := newISCReader(client)
+	inv, err := r.ReadInventory()
+	if err != nil {
+		t.Fatalf("Inventory failed: %v", err)
+	}
+	if inv.Count != 2 || inv.Status != respStatus[STATUS_OK] {
+		t.Errorf("Wrong inventory: %#v", inv)
+	}
+	if _, ok := inv.Tags["E0:04:01:00:46:70:7A:28"]; !ok {
+		t.Errorf("Missing tag in inventory: %#v", inv.Tags)
+	}
+}
+
+func TestISCReaderStaleResponse(t *testing.T) {
+	client, peer := net.Pipe()
+	defer client.Close()
+	defer peer.Close()
+
+	go func() {
+		fr := newFrameReader(peer)
+		// first request answered only after the second one was sent
+		if _, err := fr.ReadFrame(time.Time{}); err != nil {
+			return
+		}
+		if _, err := fr.ReadFrame(time.Time{}); err != nil {
+			return
+		}
+		peer.Write(encodeFrame(0x00, []byte{CMD_SW_VERSION, STATUS_OK, 0x01}))
+		peer.Write(encodeFrame(0x00, []byte{CMD_GET_READER_INFO, STATUS_OK, 0x02}))
+	}()
+
+	r := newISCReader(client)
+	r.timeout = 100 * time.Millisecond
+	if _, _, err := r.Command(CMD_SW_VERSION, nil); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected timeout, got %v", err)
+	}
+	r.timeout = time.Second
+	status, d, err := r.Command(CMD_GET_READER_INFO, []byte{0x00})
+	if err != nil || status != STATUS_OK || !bytes.Equal(d, []byte{0x02}) {
+		t.Errorf("Expected late response skipped: status 0x%02X, % 02X, %v", status, d, err)
+	}
+}
+
+func TestFrameReaderResync(t *testing.T) {
+	good := encodeFrame(0x00, []byte{CMD_BAUDRATE, STATUS_OK})
+	bad := encodeFrame(0x00, []byte{CMD_SW_VERSION, STATUS_OK})
+	bad[len(bad)-1] ^= 0xFF // broken CRC
+
+	// garbage and a corrupt frame before the real frame
+	in := append([]byte{0x00, 0x13, 0x37}, bad...)
+	in = append(in, good...)
+	got, err := newFrameReader(bytes.NewReader(in)).ReadFrame(time.Time{})
+	if err != nil {
+		t.Fatalf("Frame not found: %v", err)
+	}
+	if !bytes.Equal(got, good) {
+		t.Errorf("Wrong frame:\ngot:  % 02X\nwant: % 02X\n", got, good)
+	}
+
+	// a reader that never completes a frame times out
+	_, err = newFrameReader(&emptyReader{}).ReadFrame(time.Now().Add(50 * time.Millisecond))
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected timeout, got: %v", err)
+	}
+	_, err = newFrameReader(&emptyReader{data: bad}).ReadFrame(time.Now().Add(50 * time.Millisecond))
+	if !errors.Is(err, ErrCRC) {
+		t.Errorf("Expected CRC error, got: %v", err)
+	}
+}
+
+// emptyReader behaves like a serial port timing out after data is read
+type emptyReader struct {
+	data []byte
+}
+
+func (r *emptyReader) Read(b []byte) (int, error) {
+	if len(r.data) > 0 {
+		n := copy(b, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	time.Sleep(10 * time.Millisecond)
+	return 0, nil
+}
@@ -1,29 +1,16 @@
-package main
+//go:build !emulator
 
-/*
-#cgo CFLAGS: -I../drivers -g -Wall
-#cgo linux LDFLAGS: -L. -lfeusb -lfetcp -lfeisc
-#cgo windows LDFLAGS: -L../drivers/vc141 -lfeusb -lfetcp -lfeisc
-#cgo android LDFLAGS: -L../drivers/arm64-v8a -lfetcp -lfeusb -lfeisc -lfecom -lusb1.0
-#cgo arm64 LDFLAGS: -L../drivers/android/arm64-v8a -lfetcp -lfeusb -lfeisc -lfecom -lusb1.0
-#cgo armv7-a LDFLAGS: -L../drivers/armv7-a -lfetcp -lfeusb -lfeisc -lfecom -lstdc++ -lusb-1.0
-#cgo armv7-a CFLAGS: -mfloat-abi=hard -mfpu=vfp -mtls-dialect=gnu -march=armv7-a
-//#cgo arm LDFLAGS: -L../drivers/arm -lfeudp -lfeusb -lfeisp
-//#cgo arm CFLAGS: -mfloat-abi=hard -mfpu=vfp -march=armv6+fp
-#include <stdlib.h>
-#include "../drivers/feusb.h"
-#include "../drivers/feisc.h"
-#include "../drivers/fetcp.h"
-#include "../drivers/libusb.h"
-*/
-import "C"
+package main
 
 import (
 	"flag"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"net/http/pprof"
+	"strconv"
+	"strings"
 
 	"embed"
 
@@ -31,7 +18,6 @@ import (
 )
 
 var (
-	CRCTable [256]uint16 = makeCRCTable() // CRC CCITT reversed table for fast lookup
 	//go:embed html
 	staticFiles embed.FS
 )
@@ -43,8 +29,23 @@ func main() {
 	wake := flag.Bool("wake", true, "Keep inventory state and keep all transponders awake, will not be able to read tag content")
 	tls := flag.Bool("tls", false, "use tls, read cert.pem and key.pem from same folder")
 	library := flag.String("library", "02030000", "library ISIL number")
-	axeHost := flag.String("axeHost", "", "host of feiging axe")
+	axeHost := flag.String("axeHost", "", "host of feiging axe, or comma separated list of hosts (host or host:port) for several readers")
 	axePort := flag.Int("axePort", 0, "port of feiging axe")
+	serialPort := flag.String("serial", "", "serial port of reader, e.g. /dev/ttyUSB0 or COM3")
+	baud := flag.Int("baud", 38400, "baud rate of serial reader")
+	parity := flag.String("parity", "E", "parity of serial reader (N, E or O)")
+	virtual := flag.Int("virtual", 0, "use a virtual reader with given number of simulated tags, no hardware needed")
+	antennas := flag.String("antennas", "", "comma separated antenna numbers (1-8) used for inventory, e.g. 1,2 (default: as configured in reader)")
+	notify := flag.String("notify", "", "listen on given TCP address (e.g. :10005) for Notification Mode frames pushed by network readers")
+	brm := flag.Bool("brm", false, "use Buffered Read Mode, reader scans autonomously and the server reads its data buffer")
+	outputs := flag.String("outputs", "", "names of reader outputs, e.g. led=out1,buzzer=out2,relay=rel1 (the default)")
+	outputRules := flag.String("outputRules", "", "set outputs on events, e.g. addTag=buzzer:on:200ms,writeAFIFail=led:flash:2s+buzzer:on:1s")
+	inputs := flag.Bool("inputs", false, "poll reader digital inputs and send inputChanged events")
+	security := flag.String("security", "afi", "theft security set by alarmOn and alarmOff: afi, eas (NXP EAS bit) or both")
+	passwords := flag.String("passwords", "", "NXP tag passwords, 4 bytes in hex, e.g. read=01020304,write=0A0B0C0D (also privacy, destroy, easafi)")
+	originalityKey := flag.String("originalityKey", "", "public key verifying originality signatures of NXP tags in hex, 04 followed by X and Y (default: NXP's ICODE key, the virtual tags' key with -virtual)")
+	inputTrigger := flag.String("inputTrigger", "", "comma separated input numbers (1-8) reading inventory once when active, e.g. a light barrier (implies -inputs)")
+	rfIdle := flag.Duration("rfIdle", 0, "switch RF field off when not scanning for this long, e.g. 5m (default: always on)")
 	debug := flag.Bool("debug", false, "turn on verbose logging")
 	flag.Parse()
 
@@ -52,26 +53,113 @@ func main() {
 		l.PrintDebug = true
 	}
 
-	var iPortHandle C.int
-	var err error
-	if *axeHost != "" && *axePort != 0 {
-		l.Printf("Connecting to axe at host %s port %d", *axeHost, *axePort)
-		iPortHandle, err = C.FETCP_Connect(C.CString(*axeHost), C.int(*axePort))
+	var readers []Device
+	if *virtual > 0 {
+		l.Printf("Using virtual reader with %d tags", *virtual)
+		readers = append(readers, newVirtualReader(*virtual))
+	} else if *serialPort != "" {
+		l.Printf("Connecting to serial reader at %s", *serialPort)
+		sr, err := openSerial(*serialPort, *baud, *parity)
+		if err != nil {
+			log.Fatalf("No RFID Device found! ERROR: %s", err)
+		}
+		readers = append(readers, sr)
 	} else {
-		iPortHandle, err = C.FEUSB_ScanAndOpen(C.FEUSB_SCAN_FIRST, nil)
+		// all network readers given, and all readers on USB
+		for _, host := range strings.Split(*axeHost, ",") {
+			if host == "" {
+				continue
+			}
+			addr := host
+			if _, _, err := net.SplitHostPort(host); err != nil {
+				addr = net.JoinHostPort(host, strconv.Itoa(*axePort))
+			}
+			l.Printf("Connecting to axe at %s", addr)
+			ir, err := dialISC(addr)
+			if err != nil {
+				l.Printf("No RFID Device found!")
+				l.Printf("ERROR: %s\n", err)
+			}
+			readers = append(readers, ir)
+		}
+		ur, err := openUSB(l)
+		if err != nil && len(readers) == 0 {
+			l.Printf("No RFID Device found!")
+			l.Printf("ERROR: %s\n", err)
+		}
+		readers = append(readers, ur...)
+		if len(readers) == 0 {
+			log.Fatal("No reader available, use -serial for a serial reader or -axeHost and -axePort for a network reader")
+		}
 	}
-	if iPortHandle < 0 {
-		l.Printf("No RFID Device found!")
-		errBuf := make([]C.char, 56)
-		C.FEUSB_GetErrorText(C.int(iPortHandle), &errBuf[0])
-		l.Printf("ERROR: %d, %s\n", iPortHandle, C.GoString(&errBuf[0]))
 
+	ants, err := parseAntennas(*antennas)
+	if err != nil {
+		log.Fatal(err)
+	}
+	outputNames, err := parseOutputNames(*outputs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules, err := parseOutputRules(*outputRules, outputNames)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trigger, err := parseInputs(*inputTrigger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sec, err := parseSecurity(*security)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pwds, err := parsePasswords(*passwords)
+	if err != nil {
+		log.Fatal(err)
+	}
+	key, err := parseOriginalityKey(*originalityKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *virtual > 0 && *originalityKey == "" {
+		// simulated tags are signed with a key of their own
+		key = &virtualOriginalityKey.PublicKey
+	}
+	h := newHub(l)
+	notifying := 0
+	for _, r := range readers {
+		l.Debug(r)
+		s := newServer(r, *wake, l, *library)
+		s.rfIdle = *rfIdle
+		s.outputNames = copyOutputNames(outputNames)
+		s.outputRules = rules
+		s.pollInputs = *inputs || trigger != 0
+		s.inputTrigger = trigger
+		s.security = sec
+		s.passwords = pwds
+		s.antennas = ants
+		s.originalityKey = key
+		if *brm {
+			s.opMode = OPMODE_BUFFERED
+		}
+		if _, ok := r.(*ISCReader); ok && *notify != "" {
+			s.opMode = OPMODE_NOTIFICATION
+			notifying++
+		}
+		if err := s.setupReader(); err != nil {
+			log.Fatalf("Could not set up reader %s: %s", r.Info().Name, err)
+		}
+		h.add(s)
+	}
+	if *notify != "" && notifying == 0 {
+		log.Fatal("Notification Mode needs network readers (-axeHost), no reader would send notifications")
+	}
+	go h.run()
+	if *notify != "" {
+		go func() {
+			log.Fatal(h.ListenNotifications(*notify))
+		}()
 	}
-
-	r := newReader(iPortHandle)
-	l.Debug(r)
-	s := newServer(r, *wake, l, *library)
-	go s.readRFID()
 
 	/*
 	 * HANDLERS
@@ -88,16 +176,16 @@ func main() {
 	//http.HandleFunc("/index.html", s.sendIndexFile)
 
 	// API
-	mux.HandleFunc("/events/", s.esHandler)
-	mux.HandleFunc("/.status", s.statusHandler)
-	mux.HandleFunc("/scan", s.scanOnce)
-	mux.HandleFunc("/start", s.handleStart)
-	mux.HandleFunc("/stop", s.handleStop)
-	mux.HandleFunc("/write", s.writeTags)
-	mux.HandleFunc("/writetagbarcode", s.writeTagBarcode)
-
-	mux.HandleFunc("/alarmOff", s.alarmOff)
-	mux.HandleFunc("/alarmOn", s.alarmOn)
+	mux.HandleFunc("/events/", h.esHandler)
+	mux.HandleFunc("/readers", h.readersHandler)
+	mux.HandleFunc("/readers/", h.readersHandler)
+	s := h.defaultServer()
+	for route, handle := range readerRoutes {
+		handle := handle
+		mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+			handle(s, w, r)
+		})
+	}
 
 	// debug pprof handlers
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
@@ -0,0 +1,79 @@
+package main
+
+/*
+ * Memory layout of tags: block size and number of blocks
+ *
+ * Taken from system information of the tag, or from the chip table by UID if the tag
+ * does not answer Get System Information. Reads and writes of the data model are sized
+ * from the layout, e.g. 8 blocks of 4 bytes or 4 blocks of 8 bytes.
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// bytes of the Danish data model, see TagContent
+const dataModelSize = 32
+
+var ErrDataModelTooLarge error = errors.New("data model does not fit tag memory")
+
+// MemoryLayout is block size in bytes and number of blocks of a tag
+type MemoryLayout struct {
+	BlockSize int
+	Blocks    int
+}
+
+// known chips by UID prefix: E0, manufacturer code, chip type
+var chipLayouts = []struct {
+	Prefix []byte
+	Chip   string
+	Layout MemoryLayout
+}{
+	{[]byte{0xE0, 0x04, 0x01}, "NXP ICODE SLI/SLIX", MemoryLayout{BlockSize: 4, Blocks: 28}},
+	{[]byte{0xE0, 0x04, 0x02}, "NXP ICODE SLI-S/SLIX-S", MemoryLayout{BlockSize: 4, Blocks: 40}},
+	{[]byte{0xE0, 0x04, 0x03}, "NXP ICODE SLI-L/SLIX-L", MemoryLayout{BlockSize: 4, Blocks: 8}},
+	{[]byte{0xE0, 0x07}, "TI Tag-it HF-I", MemoryLayout{BlockSize: 4, Blocks: 64}},
+	{[]byte{0xE0, 0x08}, "Fujitsu MB89R118", MemoryLayout{BlockSize: 8, Blocks: 256}},
+	{[]byte{0xE0, 0x16}, "EM4233", MemoryLayout{BlockSize: 4, Blocks: 52}},
+}
+
+/*
+memory layout of tag from system information or chip table
+unknown tags are assumed to have 4 byte blocks and room for the data model, as all tags did before
+*/
+func tagLayout(t *Tag) MemoryLayout {
+	if si := t.SystemInfo; si != nil && si.Blocks > 0 && si.BlockSize > 0 {
+		return MemoryLayout{BlockSize: si.BlockSize, Blocks: si.Blocks}
+	}
+	for _, c := range chipLayouts {
+		if bytes.HasPrefix(t.Id, c.Prefix) {
+			return c.Layout
+		}
+	}
+	return MemoryLayout{BlockSize: 4, Blocks: dataModelSize / 4}
+}
+
+// number of blocks holding the data model
+func (l MemoryLayout) dataBlocks() (int, error) {
+	n := (dataModelSize + l.BlockSize - 1) / l.BlockSize
+	if n > l.Blocks {
+		return 0, fmt.Errorf("%w: %d bytes needed, tag has %d blocks of %d bytes", ErrDataModelTooLarge, dataModelSize, l.Blocks, l.BlockSize)
+	}
+	return n, nil
+}
+
+// blocks to write data model of tag: DB-N, DB-SIZE and data
+func contentBlocks(t *Tag) (byte, byte, []byte, error) {
+	l := tagLayout(t)
+	n, err := l.dataBlocks()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	bs, err := t.Content.ToBlocks(l.BlockSize)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return byte(n), byte(l.BlockSize), bs[:n*l.BlockSize], nil
+}
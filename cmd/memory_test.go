@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemoryLayout(t *testing.T) {
+	r := newVirtualReader(0)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+
+	// Fujitsu FRAM with 8 byte blocks, and a tag too small for the data model
+	fram := newTransponder([]byte{0xE0, 0x08, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01}, 256, 8)
+	small := newTransponder([]byte{0xE0, 0x99, 0x01, 0x00, 0x00, 0x00, 0x00, 0x02}, 6, 4)
+	r.sim.add(fram)
+	r.sim.add(small)
+
+	s.ReadTagsInRange()
+	if _, err := s.WriteTagBarcode("E0:08:01:00:00:00:00:01", "03011339851014"); err != nil {
+		t.Fatalf("Write to tag with 8 byte blocks failed: %v", err)
+	}
+	tag := Tag{Id: fram.UID, SystemInfo: &SystemInfo{BlockSize: 8, Blocks: 256}}
+	d, err := r.ReadTagContent(&tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc, err := newTagContent(d); err != nil || tc.Barcode != "03011339851014" {
+		t.Errorf("Wrong content of tag with 8 byte blocks: %#v, %v", tc, err)
+	}
+	// fewer blocks than the data model, e.g. a short read
+	if _, err := newTagContent(append([]byte{2}, d[1:2+2*9]...)); err == nil {
+		t.Errorf("Expected error on content shorter than data model")
+	}
+
+	// not in inventory, content can not be read
+	if _, ok := s.inventory["E0:99:01:00:00:00:00:02"]; ok {
+		t.Errorf("Expected tag too small for data model left out of inventory")
+	}
+	tag = Tag{Id: small.UID, SystemInfo: s.systemInfo(&Tag{Id: small.UID, Mac: tagIDtoMAC(small.UID)})}
+	if _, err := r.ReadTagContent(&tag); !errors.Is(err, ErrDataModelTooLarge) {
+		t.Errorf("Expected data model too large reading small tag, got: %v", err)
+	}
+	if _, err := r.WriteTagContent(tag); !errors.Is(err, ErrDataModelTooLarge) {
+		t.Errorf("Expected data model too large writing small tag, got: %v", err)
+	}
+
+	// layout from chip table without system information
+	if l := tagLayout(&Tag{Id: []byte{0xE0, 0x04, 0x03, 0x00, 0x00, 0x00, 0x00, 0x01}}); l != (MemoryLayout{BlockSize: 4, Blocks: 8}) {
+		t.Errorf("Wrong layout of ICODE SLI-L: %+v", l)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+/*
+ * Notification Mode: network readers connect to the host and push tag data, instead of being polled
+ *
+ * notification: STX LENGTH(2) ADDR 0x22 STATUS TR-DATA DATA-SETS(2) {record} CRC16(2)
+ * acknowledge:  STX LENGTH(2) ADDR 0x32 CRC16(2)
+ *
+ * Records are the same as in Buffered Read Mode (see brm.go). Destination host and port,
+ * and acknowledge, are set in the reader configuration.
+ */
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// listen for notification connections from readers
+func (h *hub) ListenNotifications(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	h.Log.Printf("Listening for reader notifications at %s", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go h.serveNotifications(conn)
+	}
+}
+
+// read notification frames from a reader until it disconnects
+func (h *hub) serveNotifications(conn net.Conn) {
+	defer conn.Close()
+	s := h.notifyingServer(conn.RemoteAddr())
+	if s == nil {
+		h.Log.Printf("Notification from unknown reader %s, closing", conn.RemoteAddr())
+		return
+	}
+	h.Log.Printf("Reader %s sends notifications from %s", s.Id, conn.RemoteAddr())
+	fr := newFrameReader(conn)
+	for {
+		b, err := fr.ReadFrame(time.Time{})
+		if err != nil {
+			h.Log.Printf("Notifications from reader %s ended: %v", s.Id, err)
+			return
+		}
+		f, err := decodeFrame(b)
+		if err != nil || f.Cmd != CMD_READ_BUFFER {
+			// e.g. keep-alive
+			continue
+		}
+		if f.Status == STATUS_OK || f.Status == STATUS_MORE_DATA_AVAILABLE {
+			tags, err := decodeBufferRecords(f.Data)
+			if err != nil {
+				s.Log.Debugf("ERROR DECODING NOTIFICATION: %v", err)
+			}
+			s.notify(tags)
+		}
+		// reader removes records from its buffer when acknowledged
+		if _, err := conn.Write(encodeFrame(f.Addr, []byte{CMD_CLEAR_BUFFER})); err != nil {
+			h.Log.Printf("Acknowledging notification from reader %s failed: %v", s.Id, err)
+			return
+		}
+		s.processNotified()
+	}
+}
+
+// server of network reader at address, or the only server if there is just one
+func (h *hub) notifyingServer(addr net.Addr) *server {
+	ip := addrIP(addr)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.servers {
+		if s.opMode != OPMODE_NOTIFICATION {
+			continue
+		}
+		host, _, err := net.SplitHostPort(s.Reader.Info().Name)
+		if err != nil || ip == nil {
+			continue
+		}
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			continue
+		}
+		for _, rip := range ips {
+			if rip.Equal(ip) {
+				return s
+			}
+		}
+	}
+	if len(h.servers) == 1 && h.servers[0].opMode == OPMODE_NOTIFICATION {
+		return h.servers[0]
+	}
+	return nil
+}
+
+func addrIP(addr net.Addr) net.IP {
+	if ta, ok := addr.(*net.TCPAddr); ok {
+		return ta.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(strings.Trim(host, "[]"))
+}
+
+// record tags pushed by reader, processed as inventory by processNotified and ReadTagsInRange
+func (s *server) notify(tags []Tag) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tags {
+		s.seen[t.Mac] = seenTag{Tag: t, At: now}
+	}
+}
+
+// process notified tags as they arrive when scanning, instead of waiting for the scan loop
+func (s *server) processNotified() {
+	s.mu.Lock()
+	m := s.mode
+	s.mu.Unlock()
+	if m == modeScan {
+		s.processSeen(nil)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNotifications(t *testing.T) {
+	// tags in simulator, for reading content of notified tags
+	r := newVirtualReader(2)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+	s.opMode = OPMODE_NOTIFICATION
+	h := newHub(Logger{})
+	h.add(s)
+
+	reader, host := net.Pipe()
+	defer reader.Close()
+	go h.serveNotifications(host)
+
+	// two records, UID and antenna
+	data := []byte{CMD_READ_BUFFER, STATUS_OK, BRM_TR_DATA_UID | BRM_TR_DATA_ANT, 0x00, 0x02}
+	for i, ant := range []byte{1, 2} {
+		data = append(data, TRTYPE_ISO15693, 8, 0xE0, 0x04, 0x01, 0x50, 0x00, 0x00, 0x00, byte(i+1), ant)
+	}
+	reader.SetDeadline(time.Now().Add(time.Second))
+	if _, err := reader.Write(encodeFrame(0xFF, data)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := newFrameReader(reader).ReadFrame(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("No acknowledge: %v", err)
+	}
+	if string(b) != string(encodeFrame(0xFF, []byte{CMD_CLEAR_BUFFER})) {
+		t.Fatalf("Wrong acknowledge: %X", b)
+	}
+
+	s.mu.Lock()
+	n := len(s.seen)
+	s.mu.Unlock()
+	if n != 2 {
+		t.Fatalf("Expected 2 tags notified, got %d", n)
+	}
+	inv := s.ReadTagsInRange()
+	if tag, ok := inv["E0:04:01:50:00:00:00:02"]; len(inv) != 2 || !ok || tag.Antenna != 2 {
+		t.Errorf("Wrong inventory from notifications: %#v", inv)
+	}
+}
+
+func TestNotificationsWhileScanning(t *testing.T) {
+	r := newVirtualReader(1)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+	s.opMode = OPMODE_NOTIFICATION
+	s.mode = modeScan
+	h := newHub(Logger{})
+	h.add(s)
+
+	reader, host := net.Pipe()
+	defer reader.Close()
+	go h.serveNotifications(host)
+
+	data := []byte{CMD_READ_BUFFER, STATUS_OK, BRM_TR_DATA_UID, 0x00, 0x01,
+		TRTYPE_ISO15693, 8, 0xE0, 0x04, 0x01, 0x50, 0x00, 0x00, 0x00, 0x01}
+	reader.SetDeadline(time.Now().Add(time.Second))
+	if _, err := reader.Write(encodeFrame(0xFF, data)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newFrameReader(reader).ReadFrame(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("No acknowledge: %v", err)
+	}
+
+	// processed without waiting for scan loop
+	select {
+	case msg := <-s.broadcast:
+		if msg.Event != "addTag" {
+			t.Errorf("Expected addTag event, got: %s %s", msg.Event, msg.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Notified tag not processed")
+	}
+}
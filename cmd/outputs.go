@@ -0,0 +1,198 @@
+package main
+
+/*
+ * Digital outputs of reader (CMD_SET_OUTPUT, 0x72): LED, buzzer and relay, as wired in the reader
+ *
+ * request: MODE(0x01), OUT-N, {OUT-NR, OUT-S, OUT-TIME(2)}
+ * OUT-NR:  bits 7-5 type (output or relay), bits 4-0 number from 1
+ * OUT-S:   bits 1-0 state (on, off, flash), bits 3-2 flash frequency
+ * OUT-TIME: in 100ms steps, state is kept until next request if 0
+ *
+ * Outputs can be set with /output, or automatically on events by rules, see parseOutputRules
+ */
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OUTPUT_TYPE_OUT   = 0x00
+	OUTPUT_TYPE_RELAY = 0x20
+
+	OUTPUT_ON    = 0x01
+	OUTPUT_OFF   = 0x02
+	OUTPUT_FLASH = 0x03
+)
+
+var ErrOutput error = errors.New("unknown output")
+
+var outputStates = map[string]byte{
+	"on":    OUTPUT_ON,
+	"off":   OUTPUT_OFF,
+	"flash": OUTPUT_FLASH,
+}
+
+// flash frequency in Hz, bits 3-2 of OUT-S
+var flashFrequencies = map[int]byte{8: 0x00, 4: 0x04, 2: 0x08, 1: 0x0C}
+
+// names of outputs, as wired in most ID ISC.MR101 installations; changed with -outputs
+var defaultOutputNames = map[string]string{
+	"led":    "out1",
+	"buzzer": "out2",
+	"relay":  "rel1",
+}
+
+// events outputs can be set on
+var outputEvents = map[string]bool{
+	"addTag":             true,
+	"removeTag":          true,
+	"tagMoved":           true,
+	"writeTagFail":       true,
+	"writeAFIFail":       true,
+	"readerDisconnected": true,
+	"readerConnected":    true,
+	"inputChanged":       true,
+}
+
+// outputRecord is OUT-NR, OUT-S, OUT-TIME of a set output request
+type outputRecord struct {
+	Nr    byte
+	State byte
+	Time  uint16
+}
+
+// set one or more outputs of reader
+func setOutputs(d Device, recs ...outputRecord) error {
+	req := []byte{0x01, byte(len(recs))}
+	for _, r := range recs {
+		req = append(req, r.Nr, r.State)
+		req = append(req, u16tob(r.Time)...)
+	}
+	return controlCommand(d, CMD_SET_OUTPUT, req)
+}
+
+// output number of out1-out31 or rel1-rel31, or of a name in names
+func parseOutput(output string, names map[string]string) (byte, error) {
+	if o, ok := names[output]; ok {
+		output = o
+	}
+	var typ byte
+	switch {
+	case strings.HasPrefix(output, "out"):
+		typ = OUTPUT_TYPE_OUT
+	case strings.HasPrefix(output, "rel"):
+		typ = OUTPUT_TYPE_RELAY
+	default:
+		return 0, fmt.Errorf("%w '%s'", ErrOutput, output)
+	}
+	nr, err := strconv.Atoi(output[3:])
+	if err != nil || nr < 1 || nr > 0x1F {
+		return 0, fmt.Errorf("%w '%s'", ErrOutput, output)
+	}
+	return typ | byte(nr), nil
+}
+
+// output record of output, state (on, off or flash), flash frequency and duration (0 keeps state)
+func newOutputRecord(output, state string, freq int, d time.Duration, names map[string]string) (outputRecord, error) {
+	nr, err := parseOutput(output, names)
+	if err != nil {
+		return outputRecord{}, err
+	}
+	s, ok := outputStates[state]
+	if !ok {
+		return outputRecord{}, fmt.Errorf("output state must be on, off or flash, not '%s'", state)
+	}
+	if s == OUTPUT_FLASH {
+		f, ok := flashFrequencies[freq]
+		if !ok {
+			return outputRecord{}, fmt.Errorf("flash frequency must be 1, 2, 4 or 8 Hz, not %d", freq)
+		}
+		s |= f
+	}
+	steps := d / (100 * time.Millisecond)
+	if d < 0 || steps > 0xFFFF {
+		return outputRecord{}, fmt.Errorf("output duration %s out of range", d)
+	}
+	return outputRecord{Nr: nr, State: s, Time: uint16(steps)}, nil
+}
+
+// copy of output names, so servers don't share a map
+func copyOutputNames(names map[string]string) map[string]string {
+	c := make(map[string]string, len(names))
+	for k, v := range names {
+		c[k] = v
+	}
+	return c
+}
+
+/*
+Parse names of outputs, e.g. led=out1,buzzer=out2,relay=rel1
+*/
+func parseOutputNames(spec string) (map[string]string, error) {
+	names := copyOutputNames(defaultOutputNames)
+	for _, n := range strings.Split(spec, ",") {
+		if n == "" {
+			continue
+		}
+		name, output, ok := strings.Cut(n, "=")
+		if !ok {
+			return nil, fmt.Errorf("output name must be name=output, not '%s'", n)
+		}
+		if _, err := parseOutput(output, nil); err != nil {
+			return nil, err
+		}
+		names[name] = output
+	}
+	return names, nil
+}
+
+/*
+Parse rules setting outputs on events: event=output:state:duration, several outputs joined by +
+and rules separated by comma. Flashing is at 2 Hz.
+e.g. addTag=buzzer:on:200ms,writeAFIFail=led:flash:2s+buzzer:on:1s
+*/
+func parseOutputRules(spec string, names map[string]string) (map[string][]outputRecord, error) {
+	rules := make(map[string][]outputRecord)
+	for _, rule := range strings.Split(spec, ",") {
+		if rule == "" {
+			continue
+		}
+		event, actions, ok := strings.Cut(rule, "=")
+		if !ok || !outputEvents[event] {
+			return nil, fmt.Errorf("output rule must be event=output:state:duration with a known event, not '%s'", rule)
+		}
+		for _, a := range strings.Split(actions, "+") {
+			parts := strings.Split(a, ":")
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("output action must be output:state:duration, not '%s'", a)
+			}
+			d, err := time.ParseDuration(parts[2])
+			if err != nil {
+				return nil, err
+			}
+			rec, err := newOutputRecord(parts[0], parts[1], 2, d, names)
+			if err != nil {
+				return nil, err
+			}
+			rules[event] = append(rules[event], rec)
+		}
+	}
+	return rules, nil
+}
+
+// set outputs by rules for event, in background to not hold up event handling
+func (s *server) signal(event string) {
+	recs := s.outputRules[event]
+	if len(recs) == 0 {
+		return
+	}
+	go func() {
+		if err := setOutputs(s.Reader, recs...); err != nil {
+			s.Log.Debugf("ERROR SETTING OUTPUTS ON %s: %v", event, err)
+		}
+	}()
+}
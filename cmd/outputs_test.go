@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOutputs(t *testing.T) {
+	r := newVirtualReader(1)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+
+	req := httptest.NewRequest("GET", "/output?out=buzzer&state=on&duration=200ms", nil)
+	w := httptest.NewRecorder()
+	s.outputHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Set output failed: %d %s", w.Code, w.Body.String())
+	}
+	req = httptest.NewRequest("GET", "/output?out=rel2&state=on", nil)
+	w = httptest.NewRecorder()
+	s.outputHandler(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected error setting relay not in reader, got %d", w.Code)
+	}
+
+	names, err := parseOutputNames("led=out2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaultOutputNames["led"] == "out2" {
+		t.Errorf("Default output names changed by parsing")
+	}
+	s.outputNames["led"] = "out3"
+	if s2 := newServer(r, false, Logger{}, "02030000"); s2.outputNames["led"] == "out3" {
+		t.Errorf("Output names shared between servers")
+	}
+	s.outputRules, err = parseOutputRules("addTag=led:flash:1s+relay:on:500ms", names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ReadTagsInRange()
+	time.Sleep(50 * time.Millisecond)
+	r.sim.mu.Lock()
+	defer r.sim.mu.Unlock()
+	if st := r.sim.outputs[OUTPUT_TYPE_OUT|2]; st != OUTPUT_FLASH|0x08 {
+		t.Errorf("Expected led flashing on addTag, got OUT-S 0x%02X", st)
+	}
+	if st := r.sim.outputs[OUTPUT_TYPE_RELAY|1]; st != OUTPUT_ON {
+		t.Errorf("Expected relay on on addTag, got OUT-S 0x%02X", st)
+	}
+
+	for _, spec := range []string{"tagSeen=led:on:1s", "addTag=lamp:on:1s", "addTag=led:blink:1s", "addTag=led:on"} {
+		if _, err := parseOutputRules(spec, names); err == nil {
+			t.Errorf("Expected error parsing rule %s", spec)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+/*
+ * NXP ICODE SLIX2 and DNA passwords and privacy mode (CMD_ISO15693_CUSTOM, MFR 0x04)
+ *
+ * Protected tags only answer after Set Password: the password is sent XOR'ed with
+ * a random number got from the tag first (Get Random Number), RN(2) repeated twice.
+ * A tag given a wrong password stays silent until it is powered up again.
+ *
+ * read:    pages protected with Protect Page (PP-CONDITION bits 0 and 4) can be read
+ * write:   protected pages (bits 1 and 5) can be written
+ * privacy: the tag answers nothing but Get Random Number and Set Password, until Set Password of the
+ *          privacy password in non-addressed mode wakes it up again until next power up
+ * easafi:  EAS and AFI can be changed
+ *
+ * Passwords are given with -passwords, 4 bytes in hex as sent to the tag, e.g. read=01020304,write=0A0B0C0D.
+ * Tags refusing a command get the passwords it needs, and the command is tried once more.
+ */
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var passwordIds = map[string]byte{
+	"read":    NXP_PWD_READ,
+	"write":   NXP_PWD_WRITE,
+	"privacy": NXP_PWD_PRIVACY,
+	"destroy": NXP_PWD_DESTROY,
+	"easafi":  NXP_PWD_EAS_AFI,
+}
+
+// nxpCommander sends NXP custom commands to tags, see ISCReader and Reader
+type nxpCommander interface {
+	nxpCommand(cmd byte, t Tag, params ...byte) ([]byte, error)
+}
+
+// password XOR random number from tag
+func xorPassword(d nxpCommander, t Tag, pwd []byte) ([]byte, error) {
+	if len(pwd) != 4 {
+		return nil, errors.New("password must be 4 bytes")
+	}
+	rn, err := d.nxpCommand(NXP_GET_RANDOM, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(rn) < 2 {
+		return nil, errors.New("GET RANDOM NUMBER: Not enough bytes")
+	}
+	return []byte{pwd[0] ^ rn[0], pwd[1] ^ rn[1], pwd[2] ^ rn[0], pwd[3] ^ rn[1]}, nil
+}
+
+func setPassword(d nxpCommander, t Tag, id byte, pwd []byte) error {
+	xp, err := xorPassword(d, t, pwd)
+	if err != nil {
+		return err
+	}
+	_, err = d.nxpCommand(NXP_SET_PASSWORD, t, append([]byte{id}, xp...)...)
+	return err
+}
+
+func writePassword(d nxpCommander, t Tag, id byte, pwd []byte) error {
+	if len(pwd) != 4 {
+		return errors.New("password must be 4 bytes")
+	}
+	_, err := d.nxpCommand(NXP_WRITE_PASSWORD, t, append([]byte{id}, pwd...)...)
+	return err
+}
+
+func enablePrivacy(d nxpCommander, t Tag, pwd []byte) error {
+	xp, err := xorPassword(d, t, pwd)
+	if err != nil {
+		return err
+	}
+	_, err = d.nxpCommand(NXP_ENABLE_PRIVACY, t, xp...)
+	return err
+}
+
+// password of 4 bytes in hex
+func parsePassword(s string) ([]byte, error) {
+	pwd, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(pwd) != 4 {
+		return nil, fmt.Errorf("password must be 4 bytes in hex, e.g. 01020304, not '%s'", s)
+	}
+	return pwd, nil
+}
+
+// e.g. read=01020304,write=0A0B0C0D,privacy=...,destroy=...,easafi=...
+func parsePasswords(spec string) (map[byte][]byte, error) {
+	pwds := make(map[byte][]byte)
+	for _, p := range strings.Split(spec, ",") {
+		if p == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("password must be name=password, not '%s'", p)
+		}
+		id, ok := passwordIds[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown password '%s', use read, write, privacy, destroy or easafi", name)
+		}
+		pwd, err := parsePassword(value)
+		if err != nil {
+			return nil, err
+		}
+		pwds[id] = pwd
+	}
+	return pwds, nil
+}
+
+// set configured passwords of ids on NXP tag, false if none are configured
+func (s *server) setPasswords(t Tag, ids ...byte) (bool, error) {
+	set := false
+	d, err := s.nxpReader()
+	if err != nil {
+		return set, err
+	}
+	for _, id := range ids {
+		pwd, ok := s.passwords[id]
+		if !ok {
+			continue
+		}
+		if err := d.SetPassword(t, id, pwd); err != nil {
+			return set, err
+		}
+		set = true
+	}
+	return set, nil
+}
+
+// run command on tag, once more after setting passwords ids if the tag refuses it for lack of a password
+func (s *server) withPasswords(t Tag, command func() error, ids ...byte) error {
+	err := command()
+	if !isProtected(err) || !isNXP(&t) {
+		return err
+	}
+	set, perr := s.setPasswords(t, ids...)
+	if perr != nil {
+		return fmt.Errorf("setting password: %w", perr)
+	}
+	if !set {
+		return err
+	}
+	return command()
+}
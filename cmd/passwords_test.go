@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPasswords(t *testing.T) {
+	if _, err := parsePasswords("read=0102"); err == nil {
+		t.Errorf("Expected short password refused")
+	}
+	if _, err := parsePasswords("admin=01020304"); err == nil {
+		t.Errorf("Expected unknown password refused")
+	}
+	pwds, err := parsePasswords("read=01020304,write=0A0B0C0D,privacy=11223344,easafi=0xCAFEBABE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newVirtualReader(2)
+	defer r.Close()
+	protected, factory := r.sim.tags[0], r.sim.tags[1]
+	protected.Passwords = map[byte][]byte{NXP_PWD_READ: pwds[NXP_PWD_READ], NXP_PWD_WRITE: pwds[NXP_PWD_WRITE], NXP_PWD_EAS_AFI: pwds[NXP_PWD_EAS_AFI]}
+	protected.ProtectCondition = 0x33 // all blocks read and write protected
+	protected.EASAFIProtected = true
+	id := "E0:04:01:50:00:00:00:01"
+
+	// without passwords protected tag can not be read
+	s := newServer(r, false, Logger{}, "02030000")
+	s.ReadTagsInRange()
+	if _, ok := s.inventory[id]; ok {
+		t.Errorf("Expected protected tag not read without passwords")
+	}
+
+	r.sim.powerDown()
+	s = newServer(r, false, Logger{}, "02030000")
+	s.passwords = pwds
+	s.ReadTagsInRange()
+	if tag, ok := s.inventory[id]; !ok || tag.Content.Barcode != "03010000000001" {
+		t.Fatalf("Protected tag not read with passwords: %#v", tag)
+	}
+	r.sim.powerDown()
+	if _, err := s.WriteTagBarcode(id, "03010000009999"); err != nil {
+		t.Errorf("Write of protected tag failed: %v", err)
+	}
+	r.sim.powerDown()
+	do := func(h func(*server, http.ResponseWriter, *http.Request), url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(s, w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	if w := do((*server).alarmOff, "/alarmOff"); w.Code != http.StatusOK || protected.AFI != AFI_ALARM_OFF {
+		t.Errorf("Alarm off of protected tag failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// new tag with factory passwords gets configured password, and protects its first blocks
+	fid := "E0:04:01:50:00:00:00:02"
+	if w := do((*server).writePassword, "/writePassword?pwd=write&tagid="+fid); w.Code != http.StatusOK {
+		t.Fatalf("Write password failed: %d %s", w.Code, w.Body.String())
+	}
+	if !bytes.Equal(factory.password(NXP_PWD_WRITE), pwds[NXP_PWD_WRITE]) {
+		t.Errorf("Wrong password on tag: % X", factory.password(NXP_PWD_WRITE))
+	}
+	if w := do((*server).protectPage, "/protectPage?pointer=6&condition=0x02&tagid="+fid); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected protect page without read password on tag to fail, got %d", w.Code)
+	}
+	r.sim.powerDown()
+	factory.Passwords[NXP_PWD_READ] = pwds[NXP_PWD_READ]
+	if w := do((*server).protectPage, "/protectPage?pointer=6&condition=0x02&tagid="+fid); w.Code != http.StatusOK {
+		t.Fatalf("Protect page failed: %d %s", w.Code, w.Body.String())
+	}
+	r.sim.powerDown()
+	if !factory.protected(0, true) || factory.protected(6, true) || factory.protected(0, false) {
+		t.Errorf("Expected only blocks 0-5 write protected")
+	}
+
+	// tag in privacy mode is not seen, until privacy is turned off
+	if w := do((*server).privacy, "/privacy?on=1&tagid="+fid); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected privacy without confirmation refused, got %d", w.Code)
+	}
+	if w := do((*server).privacy, "/privacy?on=1&confirm=yes&tagid="+fid); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected privacy with wrong password to fail, got %d", w.Code)
+	}
+	r.sim.powerDown()
+	factory.Passwords[NXP_PWD_PRIVACY] = pwds[NXP_PWD_PRIVACY]
+	if w := do((*server).privacy, "/privacy?on=1&confirm=yes&tagid="+fid); w.Code != http.StatusOK {
+		t.Fatalf("Enable privacy failed: %d %s", w.Code, w.Body.String())
+	}
+	inv, _ := r.ReadInventory()
+	if _, ok := inv.Tags[fid]; ok || !factory.Privacy {
+		t.Errorf("Expected tag in privacy mode left out of inventory")
+	}
+	r.sim.remove(protected.UID)
+	if w := do((*server).privacy, "/privacy?on=0"); w.Code != http.StatusOK {
+		t.Fatalf("Disable privacy failed: %d %s", w.Code, w.Body.String())
+	}
+	if inv, _ := r.ReadInventory(); inv.Tags[fid].Mac != fid {
+		t.Errorf("Expected tag back in inventory after privacy off")
+	}
+}
+
+func TestWithPasswordsRetry(t *testing.T) {
+	r := newVirtualReader(1)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+	s.passwords = map[byte][]byte{NXP_PWD_WRITE: {0x0A, 0x0B, 0x0C, 0x0D}}
+	r.sim.tags[0].Passwords = map[byte][]byte{NXP_PWD_WRITE: s.passwords[NXP_PWD_WRITE]}
+	tag := Tag{Id: r.sim.tags[0].UID}
+
+	for _, tc := range []struct {
+		code  byte
+		tries int
+	}{
+		{ISO15693_ERR_LOCKED, 1}, // locked for good, no password helps
+		{ISO15693_ERR_NOT_SUPPORTED, 1},
+		{NXP_ERR_PROTECTED, 2},
+	} {
+		tries := 0
+		_ = s.withPasswords(tag, func() error {
+			tries++
+			return &StatusError{Cmd: CMD_ISO15693, Status: STATUS_TAG_ERROR, TagError: tc.code}
+		}, NXP_PWD_WRITE)
+		if tries != tc.tries {
+			t.Errorf("Tag error 0x%02X: expected %d tries, got %d", tc.code, tc.tries, tries)
+		}
+	}
+}
+
+// reader without NXP custom commands
+type plainDevice struct {
+	Device
+}
+
+func TestNXPNotSupported(t *testing.T) {
+	r := newVirtualReader(1)
+	defer r.Close()
+	s := newServer(plainDevice{r}, false, Logger{}, "02030000")
+	s.passwords = map[byte][]byte{NXP_PWD_PRIVACY: {0x11, 0x22, 0x33, 0x44}}
+	s.ReadTagsInRange()
+	w := httptest.NewRecorder()
+	s.privacy(w, httptest.NewRequest("GET", "/privacy?on=1&confirm=yes", nil))
+	if w.Code != http.StatusInternalServerError || r.sim.tags[0].Privacy {
+		t.Errorf("Expected privacy refused by reader without NXP commands, got %d", w.Code)
+	}
+}
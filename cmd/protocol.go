@@ -0,0 +1,150 @@
+package main
+
+/*
+ * FEIG host protocol commands and status bytes, shared by all reader backends
+ */
+
+import "errors"
+
+const (
+	CCITT_REVERSED = 0x1021
+	CCITT_FORWARD  = 0x8408
+	XMODEM2        = 0x8408
+	STX            = 0x02
+	BCAST          = 0xFF
+	FIRST_DEVICE   = 0x00
+
+	// Commands
+	CMD_READ_BUFFER     = 0x22 // DATA-SETS[2], Buffered Read Mode
+	CMD_BUFFER_INFO     = 0x31
+	CMD_CLEAR_BUFFER    = 0x32 // removes data sets read with CMD_READ_BUFFER
+	CMD_INIT_BUFFER     = 0x33
+	CMD_BAUDRATE        = 0x52 // kap 6.1 (s.67)
+	CMD_CTRL_SOFT_RESET = 0x63 // kap 6.3 (s.68)
+	CMD_CTRL_SYST_RESET = 0x64 // kap 6.4 (s.69)
+	CMD_SW_VERSION      = 0x65 // kap 6.5 (s.69)
+	CMD_GET_READER_INFO = 0x66 // kap 6.6 (s.71)
+	CMD_RF_RESET        = 0x69 // RF field off for a moment, transponders power up again
+	CMD_RF_ONOFF        = 0x6A // RF[1]: 0x00 off, 0x01 on
+	CMD_DIAGNOSTIC      = 0x6E // MODE[1], see readerinfo.go
+	CMD_SET_OUTPUT      = 0x72 // MODE[1], OUT-N[1], {OUT-NR, OUT-S, OUT-TIME[2]}, see outputs.go
+	CMD_GET_INPUT       = 0x74 // response INP-STATE[1], see inputs.go
+	CMD_READ_CONFIG     = 0x80 // kap 6.1 (s.64-)
+	CMD_WRITE_CONFIG    = 0x81 // kap 6.1 (s.66-)
+	CMD_SAVE_CONFIG     = 0x82 // copy configuration from RAM to EEPROM
+	CMD_SYSTEM_TIMER    = 0x86
+	CMD_ISO15693        = 0xB0 // kap 7 (s.82-)
+	CMD_ISO15693_CUSTOM = 0xB1 // MFR[1], custom command of manufacturer, see security.go
+
+	ISO15693_INVENTORY      = 0x01 // MOD[1]
+	ISO15693_STAY_QUIET     = 0x02 // MOD[1], UID[8]
+	ISO15693_WRITE_BLOCK    = 0x21 // MOD[1], UID[8], DB-ADR[1], DB-SIZE[1], DB, for tags without write multiple
+	ISO15693_LOCK_BLOCKS    = 0x22 // MOD[1], UID[8], DB-ADR[1], DB-N[1], permanently
+	ISO15693_READ_BYTES     = 0x23 // MOD[1], UID[8],BloccoIniziale[1],NBlocchi[1]
+	ISO15693_WRITE_BYTES    = 0x24 // MOD[1], UID[8],BloccoIniziale[1],NBlocchi[1],{Blocco[4]}* NBlocchi}
+	ISO15693_SELECT         = 0x25 // MOD[1], UID[8]
+	ISO15693_RESET_TO_READY = 0x26 // MOD[1], UID[8]
+	ISO15693_WRITE_AFI      = 0x27 // MOD[1], UID[8],AFI[1]
+	ISO15693_LOCK_AFI       = 0x28 // MOD[1], UID[8]
+	ISO15693_WRITE_DSFID    = 0x29 // MOD[1], UID[8],DSFID[1]
+	ISO15693_LOCK_DSFID     = 0x2A // MOD[1], UID[8]
+	ISO15693_SYSINFO        = 0x2B // MOD[1], UID[8]
+
+	// NXP ICODE SLIX custom commands (CMD_ISO15693_CUSTOM), MOD[1], UID[8]
+	MFR_NXP       = 0x04
+	NXP_SET_EAS   = 0xA2
+	NXP_RESET_EAS = 0xA3
+	NXP_LOCK_EAS  = 0xA4 // permanently
+	NXP_EAS_ALARM = 0xA5 // tag answers only with EAS set
+
+	// NXP ICODE SLIX2 and DNA password commands, see passwords.go
+	NXP_GET_RANDOM     = 0xB2 // response RN[2]
+	NXP_SET_PASSWORD   = 0xB3 // PWD-ID[1], PWD XOR RN[4]
+	NXP_WRITE_PASSWORD = 0xB4 // PWD-ID[1], PWD[4], after Set Password of PWD-ID
+	NXP_PROTECT_PAGE   = 0xB6 // PP-POINTER[1], PP-CONDITION[1], after Set Password of read and write password
+	NXP_ENABLE_PRIVACY = 0xBA // PWD XOR RN[4] of privacy password
+	NXP_READ_SIGNATURE = 0xBD // response SIGNATURE[32], see signature.go
+	NXP_PWD_READ       = 0x01
+	NXP_PWD_WRITE      = 0x02
+	NXP_PWD_PRIVACY    = 0x04
+	NXP_PWD_DESTROY    = 0x08
+	NXP_PWD_EAS_AFI    = 0x10
+
+	// MOD byte of ISO15693 inventory
+	ISO15693_MODE_MORE = 0x80 // read further data sets after STATUS_MORE_DATA_AVAILABLE
+	ISO15693_MODE_ANT  = 0x10 // ANT-SEL byte follows, data sets carry antenna numbers
+
+	// ISO-14443 Specific High level commands (FEISC_0xB0_ISOCmd)
+	ISO14443_INVENTORY   = 0x01 // MOD[1]
+	ISO14443_SELECT      = 0x25 // MOD[1], UID[8]
+	ISO14443_READ_BYTES  = 0x23 // MOD[1], UID[8],BloccoIniziale[1],NBlocchi[1]
+	ISO14443_WRITE_BYTES = 0x24 // MOD[1], UID[8],BloccoIniziale[1],NBlocchi[1]
+
+	// ISO15693 error codes, sent as data with STATUS_TAG_ERROR
+	ISO15693_ERR_NOT_SUPPORTED       = 0x01
+	ISO15693_ERR_UNKNOWN             = 0x0F
+	ISO15693_ERR_BLOCK_NOT_AVAILABLE = 0x10
+	ISO15693_ERR_ALREADY_LOCKED      = 0x11
+	ISO15693_ERR_LOCKED              = 0x12
+	ISO15693_ERR_PROGRAM             = 0x13
+	ISO15693_ERR_LOCK                = 0x14
+
+	// NXP ICODE tags refuse access to password protected pages, EAS and AFI without the password set
+	NXP_ERR_PROTECTED = ISO15693_ERR_UNKNOWN
+
+	// CFG-ADR of configuration commands: bit 7 selects EEPROM, bits 0-5 the block
+	// bit 6 saves all blocks with CMD_SAVE_CONFIG
+	CFG_LOC_EEPROM = 0x80
+	CFG_MODE_ALL   = 0x40
+	CFG_ADR_MASK   = 0x3F
+
+	// Transponder types
+	TRTYPE_ISO15693 = 0x03
+
+	// Status bytes
+	STATUS_OK                         = 0x00
+	STATUS_NO_TRANSPONDER             = 0x01
+	STATUS_CRC_ERROR                  = 0x02
+	STATUS_WRITE_ERROR                = 0x03
+	STATUS_ADDRESS_ERROR              = 0x04
+	STATUS_WRONG_TRANSPONDER          = 0x05
+	STATUS_WRONG_EEPROM               = 0x10
+	STATUS_PARAMETER_LENGHT_ERROR     = 0x11
+	STATUS_FIRMWARE_ACTIVATION_NEEDED = 0x17
+	STATUS_UNKNOWN_COMMAND            = 0x80
+	STATUS_PROTOCOL_ERROR             = 0x81
+	STATUS_UNSUPPORTED_COMMAND        = 0x82
+	STATUS_RF_COMMUNICATION_ERROR     = 0x83
+	STATUS_RF_WARNING                 = 0x84
+	STATUS_NO_VALID_DATA              = 0x92
+	STATUS_BUFFER_OVERFLOW            = 0x93
+	STATUS_MORE_DATA_AVAILABLE        = 0x94
+	STATUS_TAG_ERROR                  = 0x95
+)
+
+var respStatus = map[byte]string{
+	STATUS_OK:                         "OK",
+	STATUS_NO_TRANSPONDER:             "No transponder",
+	STATUS_CRC_ERROR:                  "CRC Error",
+	STATUS_WRITE_ERROR:                "Write Error",
+	STATUS_ADDRESS_ERROR:              "Address Error",
+	STATUS_WRONG_TRANSPONDER:          "Wrong Transponder",
+	STATUS_WRONG_EEPROM:               "Wrong EEPROM",
+	STATUS_PARAMETER_LENGHT_ERROR:     "Wrong Parameter length",
+	STATUS_FIRMWARE_ACTIVATION_NEEDED: "Firmware Activation Needed",
+	STATUS_UNKNOWN_COMMAND:            "Unknown Command",
+	STATUS_PROTOCOL_ERROR:             "Protocol Error",
+	STATUS_UNSUPPORTED_COMMAND:        "Unsupported Command",
+	STATUS_RF_COMMUNICATION_ERROR:     "RF Communication Error",
+	STATUS_RF_WARNING:                 "RF Warning",
+	STATUS_NO_VALID_DATA:              "No valid data",
+	STATUS_BUFFER_OVERFLOW:            "Buffer Overflow",
+	STATUS_MORE_DATA_AVAILABLE:        "More data available",
+	STATUS_TAG_ERROR:                  "Tag Error",
+}
+
+var (
+	ErrResourceTempUnavailable error = errors.New("resource temporarily unavailable")
+	ErrInventoryEmpty          error = errors.New("inventory empty")
+	ErrInventoryTruncated      error = errors.New("inventory truncated, reader still had more data")
+)
@@ -1,3 +1,5 @@
+//go:build feisc
+
 package main
 
 /*
@@ -21,95 +23,12 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 )
 
-const (
-	CCITT_REVERSED = 0x1021
-	CCITT_FORWARD  = 0x8408
-	XMODEM2        = 0x8408
-	STX            = 0x02
-	BCAST          = 0xFF
-	FIRST_DEVICE   = 0x00
-
-	// Commands
-	CMD_BAUDRATE        = 0x52 // kap 6.1 (s.67)
-	CMD_CTRL_SOFT_RESET = 0x63 // kap 6.3 (s.68)
-	CMD_CTRL_SYST_RESET = 0x64 // kap 6.4 (s.69)
-	CMD_SW_VERSION      = 0x65 // kap 6.5 (s.69)
-	CMD_GET_READER_INFO = 0x66 // kap 6.6 (s.71)
-	CMD_READ_CONFIG     = 0x80 // kap 6.1 (s.64-)
-	CMD_WRITE_CONFIG    = 0x81 // kap 6.1 (s.66-)
-	CMD_SYSTEM_TIMER    = 0x86
-	CMD_ISO15693        = 0xB0 // kap 7 (s.82-)
-
-	ISO15693_INVENTORY      = 0x01 // MOD[1]
-	ISO15693_STAY_QUIET     = 0x02 // MOD[1], UID[8]
-	ISO15693_READ_BYTES     = 0x23 // MOD[1], UID[8],BloccoIniziale[1],NBlocchi[1]
-	ISO15693_WRITE_BYTES    = 0x24 // MOD[1], UID[8],BloccoIniziale[1],NBlocchi[1],{Blocco[4]}* NBlocchi}
-	ISO15693_SELECT         = 0x25 // MOD[1], UID[8]
-	ISO15693_RESET_TO_READY = 0x26 // MOD[1], UID[8]
-	ISO15693_WRITE_AFI      = 0x27 // MOD[1], UID[8],AFI[1]
-	ISO15693_LOCK_AFI       = 0x28 // MOD[1], UID[8]
-	ISO15693_WRITE_DSFID    = 0x29 // MOD[1], UID[8],DSFID[1]
-	ISO15693_LOCK_DSFID     = 0x2A // MOD[1], UID[8],DSFID[1]
-	ISO15693_SYSINFO        = 0x2B // MOD[1], UID[8]
-
-	// ISO-14443 Specific High level commands (FEISC_0xB0_ISOCmd)
-	ISO14443_INVENTORY   = 0x01 // MOD[1]
-	ISO14443_SELECT      = 0x25 // MOD[1], UID[8]
-	ISO14443_READ_BYTES  = 0x23 // MOD[1], UID[8],BloccoIniziale[1],NBlocchi[1]
-	ISO14443_WRITE_BYTES = 0x24 // MOD[1], UID[8],BloccoIniziale[1],NBlocchi[1]
-
-	// Status bytes
-	STATUS_OK                         = 0x00
-	STATUS_NO_TRANSPONDER             = 0x01
-	STATUS_CRC_ERROR                  = 0x02
-	STATUS_WRITE_ERROR                = 0x03
-	STATUS_ADDRESS_ERROR              = 0x04
-	STATUS_WRONG_TRANSPONDER          = 0x05
-	STATUS_WRONG_EEPROM               = 0x10
-	STATUS_PARAMETER_LENGHT_ERROR     = 0x11
-	STATUS_FIRMWARE_ACTIVATION_NEEDED = 0x17
-	STATUS_UNKNOWN_COMMAND            = 0x80
-	STATUS_PROTOCOL_ERROR             = 0x81
-	STATUS_UNSUPPORTED_COMMAND        = 0x82
-	STATUS_RF_COMMUNICATION_ERROR     = 0x83
-	STATUS_RF_WARNING                 = 0x84
-	STATUS_NO_VALID_DATA              = 0x92
-	STATUS_BUFFER_OVERFLOW            = 0x93
-	STATUS_MORE_DATA_AVAILABLE        = 0x94
-	STATUS_TAG_ERROR                  = 0x95
-)
-
-var respStatus = map[byte]string{
-	STATUS_OK:                         "OK",
-	STATUS_NO_TRANSPONDER:             "No transponder",
-	STATUS_CRC_ERROR:                  "CRC Error",
-	STATUS_WRITE_ERROR:                "Write Error",
-	STATUS_ADDRESS_ERROR:              "Address Error",
-	STATUS_WRONG_TRANSPONDER:          "Wrong Transponder",
-	STATUS_WRONG_EEPROM:               "Wrong EEPROM",
-	STATUS_PARAMETER_LENGHT_ERROR:     "Wrong Parameter length",
-	STATUS_FIRMWARE_ACTIVATION_NEEDED: "Firmware Activation Needed",
-	STATUS_UNKNOWN_COMMAND:            "Unknown Command",
-	STATUS_PROTOCOL_ERROR:             "Protocol Error",
-	STATUS_UNSUPPORTED_COMMAND:        "Unsupported Command",
-	STATUS_RF_COMMUNICATION_ERROR:     "RF Communication Error",
-	STATUS_RF_WARNING:                 "RF Warning",
-	STATUS_NO_VALID_DATA:              "No valid data",
-	STATUS_BUFFER_OVERFLOW:            "Buffer Overflow",
-	STATUS_MORE_DATA_AVAILABLE:        "More data available",
-	STATUS_TAG_ERROR:                  "Tag Error",
-}
-
-var (
-	ErrResourceTempUnavailable error = errors.New("resource temporarily unavailable")
-	ErrInventoryEmpty          error = errors.New("inventory empty")
-)
-
 type Reader struct {
 	StrHandle    *C.char
 	PortHandle   C.int
@@ -118,36 +37,22 @@ type Reader struct {
 	IntSerial    C.long
 	Name         string
 	Family       string
-	ReadInvFail  uint64
-	ReadInvSucc  uint64
-	ReadTagFail  uint64
-	ReadTagSucc  uint64
-	WriteTagSucc uint64
-	WriteTagFail uint64
-	WriteAFISucc uint64
-	WriteAFIFail uint64
+	Antennas     byte // ANT-SEL mask for inventory, 0 uses the antennas configured in reader
+	Log          Logger
+	Counters
+	mu sync.Mutex // guards Antennas and the handles, which Reconnect replaces
 }
 
-func newReader(iPortHandle C.int) *Reader {
+// reader on port handle, index is position of reader in the FEUSB scan list
+func newReader(iPortHandle C.int, index int) *Reader {
 	iReaderHandle := C.FEISC_NewReader(iPortHandle)
 	// err handling
 	r := Reader{PortHandle: iPortHandle, ReaderHandle: iReaderHandle}
-	var resBuf []C.char
-	resBuf = make([]C.char, 56)
-	dn := C.CString("DeviceName")
-	dId := C.CString("Device-ID")
-	dFn := C.CString("FamilyName")
-	defer C.free(unsafe.Pointer(dId))
-	defer C.free(unsafe.Pointer(dFn))
-	defer C.free(unsafe.Pointer(dn))
-	_ = C.FEUSB_GetScanListPara(0, dn, &resBuf[0])
-	r.Name = C.GoString(&resBuf[0])
-	_ = C.FEUSB_GetScanListPara(0, dId, &resBuf[0])
-	r.Serial = C.GoString(&resBuf[0])
-	_ = C.FEUSB_GetScanListPara(0, dFn, &resBuf[0])
+	r.Name = scanListPara(index, "DeviceName")
+	r.Serial = scanListPara(index, "Device-ID")
 	i, _ := strconv.ParseInt(r.Serial, 16, 0)
 	r.IntSerial = C.long(i)
-	r.Family = C.GoString(&resBuf[0])
+	r.Family = scanListPara(index, "FamilyName")
 
 	//_ = C.FEUSB_GetScanListPara(0, C.CString("DeviceHnd"), &sDeviceHandle[0])
 	//_ = C.FEUSB_GetScanListPara(0, C.CString("Present"), &sDevicePresence[0])
@@ -156,29 +61,140 @@ func newReader(iPortHandle C.int) *Reader {
 	return &r
 }
 
-func (r *Reader) ReadInventory() ([]byte, error) {
+func (r *Reader) Info() DeviceInfo {
+	return DeviceInfo{Name: r.Name, Family: r.Family, Serial: r.Serial}
+}
+
+func (r *Reader) Stats() *Counters {
+	return &r.Counters
+}
+
+/*
+Reconnect closes handles, finds reader by serial in USB scan list
+and opens it again with the same setup as newReader
+Commands wait for it, as all handle use holds r.mu
+*/
+func (r *Reader) Reconnect() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = C.FEISC_DeleteReader(r.ReaderHandle)
+	_ = C.FEUSB_CloseDevice(r.PortHandle)
+	if iRes := C.FEUSB_Scan(C.FEUSB_SCAN_ALL, nil); iRes < 0 {
+		return usbError(iRes)
+	}
+	n := int(C.FEUSB_GetScanListSize())
+	for i := 0; i < n; i++ {
+		if scanListPara(i, "Device-ID") != r.Serial {
+			continue
+		}
+		iPortHandle := C.FEUSB_OpenDevice(r.IntSerial)
+		if iPortHandle < 0 {
+			return usbError(iPortHandle)
+		}
+		nr := newReader(iPortHandle, i)
+		r.PortHandle, r.ReaderHandle = nr.PortHandle, nr.ReaderHandle
+		return nil
+	}
+	return fmt.Errorf("reader %s not found on USB", r.Serial)
+}
+
+// Command sends cmd with data to reader as a transparent protocol frame, returns status and response data
+func (r *Reader) Command(cmd byte, data []byte) (byte, []byte, error) {
+	tx := encodeFrame(BCAST, append([]byte{cmd}, data...))
+	reqBuf := C.CBytes(tx)
+	defer C.free(reqBuf)
+	resBuf := make([]C.uchar, 4096)
+	r.mu.Lock()
+	iRes := C.FEISC_SendTransProtocol(r.ReaderHandle, (*C.uchar)(reqBuf), C.int(len(tx)), &resBuf[0], C.int(len(resBuf)))
+	r.mu.Unlock()
+	if iRes < 0 {
+		return 0, nil, feiscError(iRes)
+	}
+	f, err := decodeFrame(C.GoBytes(unsafe.Pointer(&resBuf[0]), iRes))
+	if err != nil {
+		return 0, nil, err
+	}
+	return f.Status, f.Data, nil
+}
+
+// FEISC error of reader not answering in time
+const feiscTimeout = -1130
+
+// extra room in response buffers, FEISC_0xB0_ISOCmd is not given the buffer size
+// and a response longer than expected (e.g. other block size) must not overrun it
+const resHeadroom = 64
+
+func feiscError(iRes C.int) error {
+	errBuf := make([]C.char, 256)
+	C.FEISC_GetErrorText(iRes, &errBuf[0])
+	return fmt.Errorf("FEISC error %d, %s", iRes, C.GoString(&errBuf[0]))
+}
+
+func (r *Reader) SetAntennas(ants byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Antennas = ants
+}
+
+/*
+ReadInventory reads all tags in field
+On STATUS_MORE_DATA_AVAILABLE the rest is read with the MORE mode bit set,
+the response buffer fits the largest data set count (1 byte) a response can hold
+*/
+func (r *Reader) ReadInventory() (*Inventory, error) {
 	var reqBuf []C.uchar
 	var resBuf []C.uchar
 	var l C.int
 	reqBuf = []C.uchar{ISO15693_INVENTORY, 0x00}
-	//resBuf = make([]C.uchar, 1024)
-	resBuf = make([]C.uchar, 512)
-	//defer C.free(unsafe.Pointer(&reqBuf))
-	//defer C.free(unsafe.Pointer(&resBuf))
-	//l := C.int(0) // pointer to data length in response
+	parse := getInventory
+	r.mu.Lock()
+	ant := r.Antennas
+	r.mu.Unlock()
+	if ant != 0 {
+		reqBuf = []C.uchar{ISO15693_INVENTORY, ISO15693_MODE_ANT, C.uchar(ant)}
+		parse = getAntennaInventory
+	}
+	// count, {trtype, dsfid, uid(8), [ant-cnt, {ant-nr, rssi} * 8]}
+	resBuf = make([]C.uchar, 1+255*(11+2*8))
 
-	// read inventory - uint8 byte response
-	// FEISC_0xB0_ISOCmd(handle, address, request, reqlength, resp, resplength, resp format (0=bytes, 2=hex))
-	//iRes, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0x00, &reqBuf[0], C.int(2), &resBuf[0], &l, 0)
-	_, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(2), &resBuf[0], &l, 0)
-	b := C.GoBytes(unsafe.Pointer(&resBuf[0]), l)
-	return b, err
+	inv := &Inventory{Tags: map[string]Tag{}}
+	for i := 0; i < maxInventoryReads; i++ {
+		// read inventory - uint8 byte response
+		// FEISC_0xB0_ISOCmd(handle, address, request, reqlength, resp, resplength, resp format (0=bytes, 2=hex))
+		r.mu.Lock()
+		iRes, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(len(reqBuf)), &resBuf[0], &l, 0)
+		r.mu.Unlock()
+		if iRes < 0 {
+			// driver error, e.g. device gone
+			return inv, feiscError(iRes)
+		}
+		b := C.GoBytes(unsafe.Pointer(&resBuf[0]), l)
+		if next, ierr := parse(b); ierr == nil {
+			inv.merge(next)
+		}
+		if iRes != C.int(STATUS_MORE_DATA_AVAILABLE) {
+			if err != nil {
+				return inv, err
+			}
+			if len(inv.Tags) == 0 {
+				return inv, ErrInventoryEmpty
+			}
+			return inv, nil
+		}
+		reqBuf[1] |= ISO15693_MODE_MORE
+	}
+	return inv, ErrInventoryTruncated
 }
 
 func (r *Reader) ReadTagContent(t *Tag) ([]byte, error) {
 	var reqBuf []C.uchar
 	var resBuf []C.uchar
 	var l C.int
+	layout := tagLayout(t)
+	n, err := layout.dataBlocks()
+	if err != nil {
+		return nil, err
+	}
 	reqLen := 12
 	reqBuf = make([]C.uchar, reqLen)
 	reqBuf[0] = C.uchar(ISO15693_READ_BYTES)
@@ -187,15 +203,18 @@ func (r *Reader) ReadTagContent(t *Tag) ([]byte, error) {
 		reqBuf[i+2] = C.uchar(t.Id[i])
 	}
 	reqBuf[10] = C.uchar(0x00) // start byte
-	reqBuf[11] = C.uchar(0x09) // 9 blocks of four bytes
-	resBuf = make([]C.uchar, 64)
+	reqBuf[11] = C.uchar(n)    // blocks of data model
+	// DB-N, DB-SIZE, {security byte, block}
+	resBuf = make([]C.uchar, 2+n*(1+layout.BlockSize)+resHeadroom)
 	//iRes, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(reqLen), &resBuf[0], &l, 0)
-	_, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(reqLen), &resBuf[0], &l, 0)
+	r.mu.Lock()
+	_, err = C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(reqLen), &resBuf[0], &l, 0)
+	r.mu.Unlock()
 	b := C.GoBytes(unsafe.Pointer(&resBuf[0]), l)
 	return b, err
 }
 
-func (r *Reader) GetSystemInformation(t *Tag) {
+func (r *Reader) GetSystemInformation(t *Tag) (*SystemInfo, error) {
 	var reqBuf []C.uchar
 	var resBuf []C.uchar
 	reqLen := 2 + len(t.Id)
@@ -210,89 +229,126 @@ func (r *Reader) GetSystemInformation(t *Tag) {
 
 	resBuf = make([]C.uchar, 64)
 
-	// Retry 5 times or give up
-	for t := 0; t < 6; t++ {
-		// FEISC_0xB0_ISOCmd(handle, address, request, reqlength, resp, resplength, resp format (0=bytes, 2=hex))
-		iRes, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(reqLen), &resBuf[0], &l, 0)
-		if err != nil && err.Error() != ErrResourceTempUnavailable.Error() && iRes != C.int(0) {
+	var err error
+	// Retry 5 times on timeouts and RF errors, tags refusing the command are not asked again
+	for i := 0; i < 6; i++ {
+		if i > 0 {
 			time.Sleep(time.Millisecond * 50)
+		}
+		// FEISC_0xB0_ISOCmd(handle, address, request, reqlength, resp, resplength, resp format (0=bytes, 2=hex))
+		r.mu.Lock()
+		iRes, _ := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(reqLen), &resBuf[0], &l, 0)
+		r.mu.Unlock()
+		if iRes == feiscTimeout {
+			err = fmt.Errorf("%w: %v", ErrTimeout, feiscError(iRes))
 			continue
 		}
-		b := C.GoBytes(unsafe.Pointer(&resBuf[0]), l)
-		fmt.Println(string(b))
+		if iRes < 0 {
+			return nil, feiscError(iRes)
+		}
+		d := C.GoBytes(unsafe.Pointer(&resBuf[0]), l)
+		if iRes == C.int(STATUS_RF_COMMUNICATION_ERROR) {
+			err = newStatusError(CMD_ISO15693, byte(iRes), d)
+			continue
+		}
+		if iRes != C.int(STATUS_OK) {
+			return nil, newStatusError(CMD_ISO15693, byte(iRes), d)
+		}
 		/*
 			RESPONSE-DATA
-			5 		6...13 	14 	15...16 	17
-			DSFID 	UID 	AFI MEM-SIZE 	IC-REF <-ISO
+			DSFID 	UID(8) 	AFI 	MEM-SIZE(2) 	IC-REF
 		*/
+		return decodeSystemInfo(d)
+	}
+	return nil, err
+}
 
-		break
+func (r *Reader) WriteTagContent(t Tag) ([]byte, error) {
+	if err := writeContent(r, &t); err != nil {
+		atomic.AddUint64(&r.WriteTagFail, 1)
+		return []byte{}, err
 	}
+	atomic.AddUint64(&r.WriteTagSucc, 1)
+	return []byte{}, nil
+}
 
+// ISO15693 command, returns status and response data
+func (r *Reader) isoCmd(req []byte, resSize int) (byte, []byte, error) {
+	reqBuf := make([]C.uchar, len(req))
+	for i, b := range req {
+		reqBuf[i] = C.uchar(b)
+	}
+	resBuf := make([]C.uchar, resSize+resHeadroom)
+	var l C.int
+	// FEISC_0xB0_ISOCmd(handle, address, request, reqlength, resp, resplength, resp format (0=bytes, 2=hex))
+	r.mu.Lock()
+	iRes, _ := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(len(reqBuf)), &resBuf[0], &l, 0)
+	r.mu.Unlock()
+	if iRes == feiscTimeout {
+		return 0, nil, fmt.Errorf("%w: %v", ErrTimeout, feiscError(iRes))
+	}
+	if iRes < 0 {
+		return 0, nil, feiscError(iRes)
+	}
+	return byte(iRes), C.GoBytes(unsafe.Pointer(&resBuf[0]), l), nil
+}
+
+func (r *Reader) readBlocks(t *Tag, start, n int) ([]byte, []bool, error) {
+	req := []byte{ISO15693_READ_BYTES, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, byte(start), byte(n))
+	status, d, err := r.isoCmd(req, 2+n*(1+tagLayout(t).BlockSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != STATUS_OK {
+		return nil, nil, newStatusError(CMD_ISO15693, status, d)
+	}
+	return decodeBlocks(d)
 }
 
 /*
-Write Tag Content:
+Write Multiple Blocks:
 0x24 Write cmd
 0x01 adressed mode
 8bytes  uid
-0x00 start block
-0x09 num blocks
-0x04 block size
-n*4bytes data blocks
+start block
+num blocks
+block size
+n*size bytes data blocks
 */
-func (r *Reader) WriteTagContent(t Tag) ([]byte, error) {
-	var reqBuf []C.uchar
-	var resBuf []C.uchar
-	var resLen C.int
-	var err error
-	bs, err := t.Content.ToBytes()
-	if err != nil {
-		return bs, err
-	}
-
-	reqLen := 13 + len(bs)
-	reqBuf = make([]C.uchar, reqLen)
-	reqBuf[0] = C.uchar(ISO15693_WRITE_BYTES)
-	reqBuf[1] = C.uchar(0x01)
-	for i := 0; i < len(t.Id); i++ {
-		reqBuf[i+2] = C.uchar(t.Id[i])
-	}
-	reqBuf[10] = C.uchar(0x00) // DB-ADR:  start block
-	reqBuf[11] = C.uchar(0x09) // DN-N:    9 blocks
-	reqBuf[12] = C.uchar(0x04) // DB-SIZE: block size 4 bytes
-	for i := 0; i < len(bs); i++ {
-		reqBuf[13+i] = C.uchar(bs[i])
-	}
-	resBuf = make([]C.uchar, 64)
-	//iRes, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(reqLen), &resBuf[0], &l, 0)
+func (r *Reader) writeBlocks(t *Tag, start, n, size int, data []byte) error {
+	req := []byte{ISO15693_WRITE_BYTES, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, byte(start), byte(n), byte(size))
+	req = append(req, data...)
 
 	/* Retry 5 times or give up */
-	for t := 0; t < 6; t++ {
-		if t == 5 {
-			atomic.AddUint64(&r.WriteTagFail, 1)
-			return []byte{}, errors.New("Timeout waiting for RFID")
-		}
+	for i := 0; i < 5; i++ {
 		time.Sleep(time.Millisecond * 100)
-		resBytes, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0x00, &reqBuf[0], C.int(reqLen), &resBuf[0], &resLen, 0)
-		if resBytes == C.int(-1130) {
-			time.Sleep(time.Millisecond * 100)
-			fmt.Printf("RETRYING WRITE... %d\n", t)
+		status, d, err := r.isoCmd(req, 64)
+		if isTimeout(err) {
+			r.Log.Debugf("RETRYING WRITE %s: %d", t.Mac, i)
 			continue
 		}
-		if err != nil {
-			// Ignore resource not available error
-			if err.Error() != ErrResourceTempUnavailable.Error() {
-				atomic.AddUint64(&r.WriteTagFail, 1)
-				return []byte{}, err
-			}
+		if err == nil && status != STATUS_OK {
+			err = newStatusError(CMD_ISO15693, status, d)
 		}
-		break
+		return err
 	}
-	atomic.AddUint64(&r.WriteTagSucc, 1)
-	b := C.GoBytes(unsafe.Pointer(&resBuf[0]), resLen)
-	return b, err
+	return errors.New("Timeout waiting for RFID")
+}
 
+func (r *Reader) writeBlock(t *Tag, block, size int, data []byte) error {
+	req := []byte{ISO15693_WRITE_BLOCK, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, byte(block), byte(size))
+	req = append(req, data...)
+	status, d, err := r.isoCmd(req, 64)
+	if err == nil && status != STATUS_OK {
+		err = newStatusError(CMD_ISO15693, status, d)
+	}
+	return err
 }
 
 /*
@@ -311,13 +367,15 @@ func (r *Reader) WriteAFIByte(t Tag, afi byte) error {
 		reqBuf[i+2] = C.uchar(t.Id[i])
 	}
 	reqBuf[10] = C.uchar(afi)
-	resBuf = make([]C.uchar, 8)
+	resBuf = make([]C.uchar, 8+resHeadroom)
 
 	var err error
 	var iRes C.int
 	// Retry 5 times or give up
 	for t := 0; t < 6; t++ {
+		r.mu.Lock()
 		iRes, err = C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(reqLen), &resBuf[0], &l, 0)
+		r.mu.Unlock()
 		if err != nil && err.Error() != ErrResourceTempUnavailable.Error() && iRes != C.int(0) {
 			if t == 5 {
 				atomic.AddUint64(&r.WriteAFIFail, 1)
@@ -332,106 +390,121 @@ func (r *Reader) WriteAFIByte(t Tag, afi byte) error {
 	return err
 }
 
-func (r *Reader) ResetToReady() error {
-	var reqBuf []C.uchar
-	var resBuf []C.uchar
-	var l C.int
+func (r *Reader) WriteDSFID(t Tag, dsfid byte) error {
+	return r.tagCommand(ISO15693_WRITE_DSFID, t, dsfid)
+}
 
-	reqBuf = []C.uchar{ISO15693_RESET_TO_READY, 0x00} /* RESET TO READY [0xB0] request - wake up transponders */
-	resBuf = make([]C.uchar, 56)
-	_, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(2), &resBuf[0], &l, 0)
-	return err
+func (r *Reader) LockAFI(t Tag) error {
+	return r.tagCommand(ISO15693_LOCK_AFI, t)
 }
 
-func (r *Reader) ReadTagsInRange(s *server) map[string]Tag {
-	now := time.Now()
-	b, err := r.ReadInventory()
-	if err != nil {
-		// don't count these, they come always
-		if err.Error() != ErrResourceTempUnavailable.Error() {
-			s.Log.Debugf("ERROR READING INVENTORY: %v", err)
-			atomic.AddUint64(&r.ReadInvFail, 1)
-		}
-	}
-	s.Log.Debugf("INVENTORY TIMING: %s", time.Since(now))
+func (r *Reader) LockDSFID(t Tag) error {
+	return r.tagCommand(ISO15693_LOCK_DSFID, t)
+}
 
-	inv, err := getInventory(b)
-	if err != nil {
-		if err.Error() != ErrInventoryEmpty.Error() {
-			s.Log.Debugf("ERROR GETTING INVENTORY: %v", err)
-			atomic.AddUint64(&r.ReadInvFail, 1)
-		}
-	} else {
-		atomic.AddUint64(&r.ReadInvSucc, 1)
-	}
-	if s.keepTranspondersAwake {
-		_ = r.ResetToReady()
+func (r *Reader) LockBlocks(t Tag, start, n int) error {
+	return r.tagCommand(ISO15693_LOCK_BLOCKS, t, byte(start), byte(n))
+}
+
+func (r *Reader) SetEAS(t Tag, on bool) error {
+	cmd := byte(NXP_RESET_EAS)
+	if on {
+		cmd = NXP_SET_EAS
 	}
+	_, err := r.nxpCommand(cmd, t)
+	return err
+}
 
-	return inv.Process(s)
+func (r *Reader) SetPassword(t Tag, id byte, pwd []byte) error {
+	return setPassword(r, t, id, pwd)
 }
 
-/*
-Overwrite barcode on single tag
-*/
+func (r *Reader) WritePassword(t Tag, id byte, pwd []byte) error {
+	return writePassword(r, t, id, pwd)
+}
 
-func (r *Reader) WriteTagBarcode(s *server, tagId, barcode string) (Tag, error) {
-	now := time.Now()
-	s.mu.Lock()
-	tag := s.inventory[tagId]
-	s.mu.Unlock()
-	tag.Content.Barcode = barcode
-	_, err := r.WriteTagContent(tag)
-	if err != nil {
-		// don't count these, they come always
-		if err.Error() != ErrResourceTempUnavailable.Error() {
-			s.Log.Debugf("ERROR READING INVENTORY: %v", err)
-			return tag, err
-		}
-	}
-	s.mu.Lock()
-	s.inventory[tagId] = tag
-	s.mu.Unlock()
-	s.Log.Debugf("WRITE TIMING: %s", time.Since(now))
-	return tag, nil
+func (r *Reader) EnablePrivacy(t Tag, pwd []byte) error {
+	return enablePrivacy(r, t, pwd)
 }
 
-/*
-TODO:
+func (r *Reader) ProtectPage(t Tag, pointer, condition byte) error {
+	_, err := r.nxpCommand(NXP_PROTECT_PAGE, t, pointer, condition)
+	return err
+}
 
-	Might need to read inventory before writing, so we confirm right number of tags
-*/
-func (r *Reader) WriteToTagsInRange(s *server, barcode string) (map[string]Tag, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	now := time.Now()
-	l := len(s.inventory)
-	c := 0
-	for id, tag := range s.inventory {
-		c++
-		tc := TagContent{
-			SeqNum:   uint8(c),
-			NumItems: uint8(l),
-			Barcode:  barcode,
-			Country:  "NO", // hard coded for now
-			Library:  s.library,
-		}
-		tag.Content = tc
-		_, err := r.WriteTagContent(tag)
-		if err != nil {
-			// don't count these, they come always
-			if err.Error() != ErrResourceTempUnavailable.Error() {
-				s.Log.Debugf("ERROR READING INVENTORY: %v", err)
-				return s.inventory, err
-			}
-		}
-		s.inventory[id] = tag
+func (r *Reader) ReadSignature(t Tag) ([]byte, error) {
+	return r.nxpCommand(NXP_READ_SIGNATURE, t)
+}
+
+func (r *Reader) LockEAS(t Tag) error {
+	_, err := r.nxpCommand(NXP_LOCK_EAS, t)
+	return err
+}
+
+// tags without EAS set do not answer EAS Alarm
+func (r *Reader) EASAlarm(t Tag) (bool, error) {
+	_, err := r.nxpCommand(NXP_EAS_ALARM, t)
+	var se *StatusError
+	if errors.As(err, &se) && se.Status == STATUS_NO_TRANSPONDER {
+		return false, nil
 	}
+	return err == nil, err
+}
 
-	s.Log.Debugf("WRITE INVENTORY TIMING: %s", time.Since(now))
-	if c == l {
-		return s.inventory, nil
-	} else {
-		return s.inventory, errors.New("Wrong count of written tags")
+// NXP custom command to tag in addressed mode, EAS Alarm answers at most 32 bytes of EAS sequence
+func (r *Reader) nxpCommand(cmd byte, t Tag, params ...byte) ([]byte, error) {
+	// non-addressed for tag without UID, e.g. in privacy mode
+	mode := byte(0x01)
+	if len(t.Id) == 0 {
+		mode = 0x00
+	}
+	req := []byte{cmd, mode}
+	req = append(req, t.Id...)
+	req = append(req, params...)
+	reqBuf := make([]C.uchar, len(req))
+	for i, b := range req {
+		reqBuf[i] = C.uchar(b)
 	}
+	resBuf := make([]C.uchar, 64)
+	var l C.int
+	// FEISC_0xB1_ISOCustAndPropCmd(handle, address, manufacturer, request, reqlength, resp, resplength, resp format)
+	r.mu.Lock()
+	iRes, _ := C.FEISC_0xB1_ISOCustAndPropCmd(r.ReaderHandle, 0xFF, MFR_NXP, &reqBuf[0], C.int(len(reqBuf)), &resBuf[0], &l, 0)
+	r.mu.Unlock()
+	if iRes == feiscTimeout {
+		return nil, fmt.Errorf("%w: %v", ErrTimeout, feiscError(iRes))
+	}
+	if iRes < 0 {
+		return nil, feiscError(iRes)
+	}
+	d := C.GoBytes(unsafe.Pointer(&resBuf[0]), l)
+	if iRes != STATUS_OK {
+		return d, newStatusError(CMD_ISO15693_CUSTOM, byte(iRes), d)
+	}
+	return d, nil
+}
+
+// ISO15693 command to tag in addressed mode, without response data
+func (r *Reader) tagCommand(sub byte, t Tag, params ...byte) error {
+	req := []byte{sub, 0x01}
+	req = append(req, t.Id...)
+	req = append(req, params...)
+	status, d, err := r.isoCmd(req, 8)
+	if err == nil && status != STATUS_OK {
+		err = newStatusError(CMD_ISO15693, status, d)
+	}
+	return err
+}
+
+func (r *Reader) ResetToReady() error {
+	var reqBuf []C.uchar
+	var resBuf []C.uchar
+	var l C.int
+
+	reqBuf = []C.uchar{ISO15693_RESET_TO_READY, 0x00} /* RESET TO READY [0xB0] request - wake up transponders */
+	resBuf = make([]C.uchar, 56)
+	r.mu.Lock()
+	_, err := C.FEISC_0xB0_ISOCmd(r.ReaderHandle, 0xFF, &reqBuf[0], C.int(2), &resBuf[0], &l, 0)
+	r.mu.Unlock()
+	return err
 }
@@ -0,0 +1,238 @@
+package main
+
+/*
+ * Reader information (CMD_GET_READER_INFO, 0x66) and diagnostic (CMD_DIAGNOSTIC, 0x6E)
+ *
+ * request:  MODE
+ * response: mode specific data, see decoders below
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// MODE of CMD_GET_READER_INFO
+const (
+	READER_INFO_RF_CONTROLLER = 0x00 // firmware of RF controller, same as CMD_SW_VERSION
+	READER_INFO_CPU           = 0x01 // firmware of application CPU (ACC)
+	READER_INFO_HARDWARE      = 0x10
+	READER_INFO_LAN_MAC       = 0x50
+	READER_INFO_LAN_IP        = 0x51
+	READER_INFO_LAN_NETMASK   = 0x52
+	READER_INFO_LAN_GATEWAY   = 0x53
+	READER_INFO_IO            = 0x60
+
+	DIAGNOSTIC_GENERAL  = 0x01 // FLAGS-A, FLAGS-B
+	DIAGNOSTIC_INTERNAL = 0x04 // INT-ERROR(2)
+)
+
+// ReaderInfo is all information a reader gives about itself, modes a reader does not support are nil
+type ReaderInfo struct {
+	Firmware *FirmwareInfo // RF controller
+	CPU      *FirmwareInfo
+	Hardware *HardwareInfo
+	IO       *IOInfo
+	LAN      *LANInfo
+}
+
+// FirmwareInfo is SW-REV(2), D-REV, HW-TYPE, SW-TYPE, TR-TYPE(2), RX-BUF(2), TX-BUF(2)
+type FirmwareInfo struct {
+	Version string // SW-REV and D-REV, e.g. 02.06.00
+	HwType  byte
+	SwType  byte   // reader type, e.g. 0x4D for ID ISC.MR101
+	TrTypes uint16 // supported transponder types, bit flags
+	RxBuf   uint16 // max bytes of request
+	TxBuf   uint16 // max bytes of response
+}
+
+// HardwareInfo is HW-INFO(2), D-TYPE, HW-REV, FREQ
+type HardwareInfo struct {
+	HwInfo    uint16
+	DType     byte
+	HwRev     byte
+	Frequency byte
+}
+
+// IOInfo is number of digital inputs, outputs and relays
+type IOInfo struct {
+	Inputs  int
+	Outputs int
+	Relays  int
+}
+
+// LANInfo is network setup of a reader with LAN interface
+type LANInfo struct {
+	MAC     string
+	IP      net.IP
+	Netmask net.IP
+	Gateway net.IP
+}
+
+// Diagnostic is RF and internal error state of reader
+type Diagnostic struct {
+	RFHardwareError      bool
+	NoiseTooHigh         bool
+	AntennaPhaseError    bool
+	AntennaImpedanceHigh bool
+	AntennaImpedanceLow  bool
+	TemperatureWarning   bool
+	TemperatureAlarm     bool
+	InternalErrors       uint16
+}
+
+// query reader info of mode, returns response data
+func readerInfoCommand(d Device, cmd, mode byte) ([]byte, error) {
+	status, data, err := d.Command(cmd, []byte{mode})
+	if err != nil {
+		return nil, err
+	}
+	if status != STATUS_OK {
+		return nil, &StatusError{Cmd: cmd, Status: status}
+	}
+	return data, nil
+}
+
+func isUnsupported(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se)
+}
+
+// read all reader info modes, modes the reader does not support are left out
+func getReaderInfo(d Device) (*ReaderInfo, error) {
+	ri := &ReaderInfo{}
+	data, err := readerInfoCommand(d, CMD_GET_READER_INFO, READER_INFO_RF_CONTROLLER)
+	if err != nil {
+		return nil, err
+	}
+	if ri.Firmware, err = decodeFirmwareInfo(data); err != nil {
+		return nil, err
+	}
+
+	if data, err = readerInfoCommand(d, CMD_GET_READER_INFO, READER_INFO_CPU); err == nil {
+		ri.CPU, err = decodeFirmwareInfo(data)
+	}
+	if err != nil && !isUnsupported(err) {
+		return ri, err
+	}
+	if data, err = readerInfoCommand(d, CMD_GET_READER_INFO, READER_INFO_HARDWARE); err == nil {
+		ri.Hardware, err = decodeHardwareInfo(data)
+	}
+	if err != nil && !isUnsupported(err) {
+		return ri, err
+	}
+	if data, err = readerInfoCommand(d, CMD_GET_READER_INFO, READER_INFO_IO); err == nil {
+		ri.IO, err = decodeIOInfo(data)
+	}
+	if err != nil && !isUnsupported(err) {
+		return ri, err
+	}
+	if ri.LAN, err = getLANInfo(d); err != nil && !isUnsupported(err) {
+		return ri, err
+	}
+	return ri, nil
+}
+
+func getLANInfo(d Device) (*LANInfo, error) {
+	mac, err := readerInfoCommand(d, CMD_GET_READER_INFO, READER_INFO_LAN_MAC)
+	if err != nil {
+		return nil, err
+	}
+	if len(mac) < 6 {
+		return nil, errors.New("LAN MAC: Not enough bytes")
+	}
+	lan := &LANInfo{MAC: net.HardwareAddr(mac[:6]).String()}
+	for mode, ip := range map[byte]*net.IP{
+		READER_INFO_LAN_IP:      &lan.IP,
+		READER_INFO_LAN_NETMASK: &lan.Netmask,
+		READER_INFO_LAN_GATEWAY: &lan.Gateway,
+	} {
+		data, err := readerInfoCommand(d, CMD_GET_READER_INFO, mode)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 4 {
+			return nil, fmt.Errorf("LAN info mode 0x%02X: Not enough bytes", mode)
+		}
+		*ip = net.IPv4(data[0], data[1], data[2], data[3])
+	}
+	return lan, nil
+}
+
+// SW-REV(2), D-REV, HW-TYPE, SW-TYPE, TR-TYPE(2), RX-BUF(2), TX-BUF(2)
+func decodeFirmwareInfo(data []byte) (*FirmwareInfo, error) {
+	if len(data) < 11 {
+		return nil, errors.New("FIRMWARE INFO: Not enough bytes")
+	}
+	return &FirmwareInfo{
+		Version: fmt.Sprintf("%02X.%02X.%02X", data[0], data[1], data[2]),
+		HwType:  data[3],
+		SwType:  data[4],
+		TrTypes: btou16(data[5:7]),
+		RxBuf:   btou16(data[7:9]),
+		TxBuf:   btou16(data[9:11]),
+	}, nil
+}
+
+// HW-INFO(2), D-TYPE, HW-REV, FREQ
+func decodeHardwareInfo(data []byte) (*HardwareInfo, error) {
+	if len(data) < 5 {
+		return nil, errors.New("HARDWARE INFO: Not enough bytes")
+	}
+	return &HardwareInfo{
+		HwInfo:    btou16(data[0:2]),
+		DType:     data[2],
+		HwRev:     data[3],
+		Frequency: data[4],
+	}, nil
+}
+
+// NO-INP, NO-OUT, NO-REL
+func decodeIOInfo(data []byte) (*IOInfo, error) {
+	if len(data) < 3 {
+		return nil, errors.New("IO INFO: Not enough bytes")
+	}
+	return &IOInfo{Inputs: int(data[0]), Outputs: int(data[1]), Relays: int(data[2])}, nil
+}
+
+// read RF and internal error state of reader
+func getDiagnostic(d Device) (*Diagnostic, error) {
+	data, err := readerInfoCommand(d, CMD_DIAGNOSTIC, DIAGNOSTIC_GENERAL)
+	if err != nil {
+		return nil, err
+	}
+	diag, err := decodeDiagnostic(data)
+	if err != nil {
+		return nil, err
+	}
+	data, err = readerInfoCommand(d, CMD_DIAGNOSTIC, DIAGNOSTIC_INTERNAL)
+	if err != nil && !isUnsupported(err) {
+		return diag, err
+	}
+	if len(data) >= 2 {
+		diag.InternalErrors = btou16(data[0:2])
+	}
+	return diag, nil
+}
+
+/*
+FLAGS-A, FLAGS-B
+FLAGS-A: bit 0 RF hardware, 1 noise, 4 antenna phase, 5 |Z| > 50 Ohm, 6 |Z| < 50 Ohm, 7 temperature warning
+FLAGS-B: bit 0 temperature alarm
+*/
+func decodeDiagnostic(data []byte) (*Diagnostic, error) {
+	if len(data) < 2 {
+		return nil, errors.New("DIAGNOSTIC: Not enough bytes")
+	}
+	a, b := data[0], data[1]
+	return &Diagnostic{
+		RFHardwareError:      a&0x01 != 0,
+		NoiseTooHigh:         a&0x02 != 0,
+		AntennaPhaseError:    a&0x10 != 0,
+		AntennaImpedanceHigh: a&0x20 != 0,
+		AntennaImpedanceLow:  a&0x40 != 0,
+		TemperatureWarning:   a&0x80 != 0,
+		TemperatureAlarm:     b&0x01 != 0,
+	}, nil
+}
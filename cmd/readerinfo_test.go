@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReaderInfo(t *testing.T) {
+	r := newVirtualReader(0)
+	defer r.Close()
+
+	ri, err := getReaderInfo(r)
+	if err != nil {
+		t.Fatalf("Reader info failed: %v", err)
+	}
+	if ri.Firmware.Version != "02.06.00" || ri.CPU.Version != "01.03.00" || ri.Firmware.RxBuf != 0x0118 {
+		t.Errorf("Wrong firmware info: %#v, %#v", ri.Firmware, ri.CPU)
+	}
+	if ri.IO == nil || ri.IO.Inputs != 2 || ri.IO.Relays != 1 {
+		t.Errorf("Wrong IO info: %#v", ri.IO)
+	}
+	if ri.LAN != nil {
+		t.Errorf("Expected no LAN info from virtual reader, got: %#v", ri.LAN)
+	}
+
+	r.sim.DiagFlags = 0x21
+	s := newServer(r, true, Logger{}, "02030000")
+	s.checkDiagnostics()
+	rec := httptest.NewRecorder()
+	s.statusHandler(rec, httptest.NewRequest("GET", "/.status", nil))
+	var status struct {
+		ReaderInfo *ReaderInfo
+		Diagnostic *Diagnostic
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Bad status response: %v", err)
+	}
+	if status.ReaderInfo == nil || status.ReaderInfo.Hardware.DType != 0x4D {
+		t.Errorf("Missing reader info in status: %s", rec.Body.String())
+	}
+	d := status.Diagnostic
+	if d == nil || !d.RFHardwareError || !d.AntennaImpedanceHigh || d.NoiseTooHigh {
+		t.Errorf("Wrong diagnostic in status: %#v", d)
+	}
+
+	// cached until diagnosticInterval has passed
+	r.sim.DiagFlags = 0x00
+	s.checkDiagnostics()
+	if !s.diagnostic.RFHardwareError {
+		t.Errorf("Expected cached diagnostic")
+	}
+	s.diagnosticRead = time.Now().Add(-diagnosticInterval)
+	s.checkDiagnostics()
+	if s.diagnostic.RFHardwareError {
+		t.Errorf("Expected diagnostic refreshed after interval")
+	}
+}
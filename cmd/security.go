@@ -0,0 +1,124 @@
+package main
+
+/*
+ * Theft security of tags, for alarmOn and alarmOff
+ *
+ * AFI: alarm on is AFI 0x07, alarm off 0xC2, for gates checking AFI
+ * EAS: NXP ICODE SLIX custom commands (CMD_ISO15693_CUSTOM, MFR 0x04), for gates checking the EAS bit
+ *
+ * request:  MFR, NXP-CMD, MODE, UID(8)
+ * response: none, EAS Alarm answers EAS sequence data if the EAS bit is set, otherwise the tag is silent
+ *
+ * The security method is chosen with -security: afi (the default), eas, or both.
+ * With both, AFI is written on all tags and EAS on NXP tags.
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	AFI_ALARM_ON  = 0x07
+	AFI_ALARM_OFF = 0xC2
+)
+
+var ErrEASNotSupported error = errors.New("tag does not support EAS")
+
+// UID prefix of NXP tags, E0 and manufacturer code
+var nxpPrefix = []byte{0xE0, MFR_NXP}
+
+func isNXP(t *Tag) bool {
+	return bytes.HasPrefix(t.Id, nxpPrefix)
+}
+
+// securityMethod turns the theft alarm of tags on and off
+type securityMethod interface {
+	setAlarm(s *server, id string, t Tag, on bool) error // s.mu must be held
+	readAlarm(d Device, t *Tag)                          // current alarm state of new tags
+}
+
+type afiSecurity struct{}
+
+func (afiSecurity) setAlarm(s *server, id string, t Tag, on bool) error {
+	afi := byte(AFI_ALARM_OFF)
+	if on {
+		afi = AFI_ALARM_ON
+	}
+	if err := s.Reader.WriteAFIByte(t, afi); err != nil {
+		return err
+	}
+	s.updateAFI(id, afi)
+	return nil
+}
+
+// AFI is read with system information
+func (afiSecurity) readAlarm(d Device, t *Tag) {}
+
+type easSecurity struct {
+	nxpOnly bool // leave other tags alone instead of failing
+}
+
+func (e easSecurity) setAlarm(s *server, id string, t Tag, on bool) error {
+	if !isNXP(&t) {
+		if e.nxpOnly {
+			return nil
+		}
+		return ErrEASNotSupported
+	}
+	d, err := s.nxpReader()
+	if err != nil {
+		return err
+	}
+	if err := d.SetEAS(t, on); err != nil {
+		return err
+	}
+	if tag, ok := s.inventory[id]; ok {
+		tag.EAS = &on
+		s.inventory[id] = tag
+	}
+	return nil
+}
+
+func (easSecurity) readAlarm(d Device, t *Tag) {
+	nd, ok := d.(nxpDevice)
+	if !ok || !isNXP(t) {
+		return
+	}
+	if on, err := nd.EASAlarm(*t); err == nil {
+		t.EAS = &on
+	}
+}
+
+// all methods, in order
+type securityMethods []securityMethod
+
+func (m securityMethods) setAlarm(s *server, id string, t Tag, on bool) error {
+	for _, sm := range m {
+		if err := sm.setAlarm(s, id, t, on); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m securityMethods) readAlarm(d Device, t *Tag) {
+	for _, sm := range m {
+		sm.readAlarm(d, t)
+	}
+}
+
+// afi, eas or both
+func parseSecurity(spec string) (securityMethod, error) {
+	switch strings.ToLower(spec) {
+	case "", "afi":
+		return afiSecurity{}, nil
+	case "eas":
+		return easSecurity{}, nil
+	case "both":
+		return securityMethods{afiSecurity{}, easSecurity{nxpOnly: true}}, nil
+	}
+	return nil, fmt.Errorf("unknown security method %q, use afi, eas or both", spec)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurity(t *testing.T) {
+	if _, err := parseSecurity("rfid"); err == nil {
+		t.Errorf("Expected unknown security method refused")
+	}
+
+	r := newVirtualReader(2)
+	defer r.Close()
+	r.sim.tags[1].EAS = true
+	ti := newTransponder([]byte{0xE0, 0x07, 0x01, 0x00, 0x00, 0x00, 0x00, 0x03}, 64, 4)
+	r.sim.add(ti)
+	s := newServer(r, false, Logger{}, "02030000")
+	s.security, _ = parseSecurity("both")
+	s.ReadTagsInRange()
+	id := "E0:04:01:50:00:00:00:01"
+
+	do := func(h func(*server, http.ResponseWriter, *http.Request), url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(s, w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+
+	// EAS state read with new tags, not known for other manufacturers
+	if eas := s.inventory[id].EAS; eas == nil || *eas {
+		t.Errorf("Expected EAS off: %v", eas)
+	}
+	if eas := s.inventory["E0:04:01:50:00:00:00:02"].EAS; eas == nil || !*eas {
+		t.Errorf("Expected EAS on: %v", eas)
+	}
+	if eas := s.inventory["E0:07:01:00:00:00:00:03"].EAS; eas != nil {
+		t.Errorf("Expected EAS of TI tag not known: %v", *eas)
+	}
+
+	// both: AFI on all tags, EAS on NXP tags
+	if w := do((*server).alarmOn, "/alarmOn"); w.Code != http.StatusOK {
+		t.Fatalf("Alarm on failed: %d %s", w.Code, w.Body.String())
+	}
+	for _, tp := range r.sim.tags {
+		if tp.AFI != AFI_ALARM_ON || tp.EAS != (tp != ti) {
+			t.Errorf("Wrong alarm of tag % X: AFI 0x%02X, EAS %v", tp.UID, tp.AFI, tp.EAS)
+		}
+	}
+	if tag := s.inventory[id]; tag.EAS == nil || !*tag.EAS || tag.SystemInfo.AFI != AFI_ALARM_ON {
+		t.Errorf("Alarm state not updated in inventory: %#v", tag)
+	}
+
+	// EAS only fails on tags without EAS
+	s.security, _ = parseSecurity("eas")
+	if w := do((*server).alarmOff, "/alarmOff"); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected alarm off to fail on TI tag, got %d", w.Code)
+	}
+	r.sim.remove(ti.UID)
+	s.ReadTagsInRange()
+	if w := do((*server).alarmOff, "/alarmOff"); w.Code != http.StatusOK {
+		t.Fatalf("Alarm off failed: %d %s", w.Code, w.Body.String())
+	}
+	for _, tp := range r.sim.tags {
+		if tp.EAS || tp.AFI != AFI_ALARM_ON {
+			t.Errorf("Expected EAS off and AFI untouched: AFI 0x%02X, EAS %v", tp.AFI, tp.EAS)
+		}
+	}
+
+	// locked EAS can not be changed
+	if w := do((*server).lockEAS, "/lockEAS?confirm=yes&tagid="+id); w.Code != http.StatusOK {
+		t.Fatalf("Lock EAS failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := do((*server).alarmOn, "/alarmOn"); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected alarm of tag with locked EAS to fail, got %d", w.Code)
+	}
+}
@@ -1,19 +1,28 @@
 package main
 
 import (
-	"fmt"
+	"crypto/ecdsa"
 	"net"
-	"strings"
 	"sync"
 	"time"
 )
 
+// reader diagnostic in status is refreshed by the scan loop this often
+const diagnosticInterval = 10 * time.Second
+
 type ServerStatus struct {
+	Id            string
 	Uptime        string
-	Reader        *Reader
+	Reader        Device
 	LastInventory map[string]Tag
 	Client        net.IP
 	Mode          string
+	Connection    string
+	Reconnects    int
+	RFOn          bool
+	ReaderInfo    *ReaderInfo
+	Diagnostic    *Diagnostic
+	OperatingMode string
 }
 
 func (s *server) ServerStatus() *ServerStatus {
@@ -21,11 +30,18 @@ func (s *server) ServerStatus() *ServerStatus {
 	uptime := now.Sub(s.startTime)
 
 	return &ServerStatus{
+		Id:            s.Id,
 		Uptime:        uptime.String(),
 		Reader:        s.Reader,
 		LastInventory: s.inventory,
 		Client:        getMyIP(),
 		Mode:          s.mode.String(),
+		Connection:    s.conn.String(),
+		Reconnects:    s.reconnects,
+		RFOn:          s.rfOn,
+		ReaderInfo:    s.readerInfo,
+		Diagnostic:    s.diagnostic,
+		OperatingMode: opModeNames[s.opMode],
 	}
 }
 
@@ -45,32 +61,62 @@ func (m modeType) String() string {
 	return [...]string{"IDLE", "READ", "READONCE", "WRITE", "WRITEAFI", "SCAN"}[m]
 }
 
+// server keeps inventory and scan mode of a single reader, see hub for all readers
 type server struct {
+	Id                    string // reader id, used in /readers/{id}/ routes and events
 	inventory             map[string]Tag
 	startTime             time.Time
 	mode                  modeType
+	conn                  connState
+	connErrors            int // consecutive connection errors
+	reconnects            int
+	rfOn                  bool
+	rfIdle                time.Duration // switch RF off when not used for this long, 0 keeps it on
+	rfActive              time.Time     // last time RF was needed
+	rfMu                  sync.Mutex    // serializes switching RF, held over reader I/O unlike mu
+	readerInfo            *ReaderInfo   // read once after connect
+	diagnostic            *Diagnostic   // refreshed every diagnosticInterval by scan loop
+	diagnosticRead        time.Time
+	opMode                byte                   // OPERATING-MODE of reader, see config.go
+	antennas              byte                   // ANT-SEL mask for inventory, 0 uses the antennas configured in reader
+	seen                  map[string]seenTag     // tags reported in Buffered Read Mode
+	processMu             sync.Mutex             // serializes processing of notified tags with scan loop
+	sysInfo               map[string]*SystemInfo // system information by tag, see systeminfo.go
+	genuineTags           map[string]bool        // originality of NXP tags, see signature.go
+	unsignedTags          map[string]bool        // NXP tags refusing to read their signature, not asked again
+	originalityKey        *ecdsa.PublicKey
+	outputNames           map[string]string         // names of outputs, e.g. buzzer, see outputs.go
+	outputRules           map[string][]outputRecord // outputs set on event
+	pollInputs            bool                      // send inputChanged events, see inputs.go
+	inputs                byte                      // INP-STATE of last poll
+	inputsKnown           bool
+	inputTrigger          byte            // inputs reading inventory once when active
+	security              securityMethod  // AFI and/or EAS for alarmOn and alarmOff, see security.go
+	passwords             map[byte][]byte // NXP passwords by password id, see passwords.go
 	keepTranspondersAwake bool
 	Log                   Logger
-	Reader                *Reader
+	Reader                Device
 	mu                    sync.Mutex
-	client                chan EsMsg
-	register              chan (chan EsMsg)
-	unregister            chan (chan EsMsg)
 	broadcast             chan EsMsg
 	library               string
 }
 
-func newServer(r *Reader, wake bool, lgr Logger, library string) *server {
+func newServer(r Device, wake bool, lgr Logger, library string) *server {
 	return &server{
 		inventory:             make(map[string]Tag, 0),
+		seen:                  make(map[string]seenTag),
+		sysInfo:               make(map[string]*SystemInfo),
+		genuineTags:           make(map[string]bool),
+		unsignedTags:          make(map[string]bool),
+		originalityKey:        nxpOriginalityKey,
+		outputNames:           copyOutputNames(defaultOutputNames),
+		security:              afiSecurity{},
 		Reader:                r,
 		keepTranspondersAwake: wake,
 		Log:                   lgr,
 		startTime:             time.Now(),
 		mode:                  modeIdle,
-		client:                make(chan EsMsg), // dummy client to safely close on register/unregister
-		register:              make(chan (chan EsMsg)),
-		unregister:            make(chan (chan EsMsg)),
+		rfOn:                  true,
 		broadcast:             make(chan EsMsg),
 		library:               library,
 	}
@@ -80,52 +126,54 @@ func newServer(r *Reader, wake bool, lgr Logger, library string) *server {
 func (s *server) readRFID() {
 	tick := time.NewTicker(100 * time.Millisecond)
 	defer tick.Stop()
-	defer func() {
-		if err := recover(); err != nil {
-			if strings.Contains(fmt.Sprintf("%v", err), "close of closed channel") {
-				s.mu.Lock()
-				s.client = make(chan EsMsg)
-				s.mu.Unlock()
-				s.readRFID()
-			}
-		}
-	}()
 
-	// Periodically check for updates to msg channel
-	for {
-		select {
-		case _ = <-tick.C:
-			s.mu.Lock()
-			m := s.mode
-			s.mu.Unlock()
-			if m == modeScan {
-				// for each tick, real all tags in range if put in READ mode
-				s.Reader.ReadTagsInRange(s)
-			}
-		case msg := <-s.broadcast:
-			select {
-			case s.client <- msg:
-			case <-time.After(300 * time.Millisecond):
-				// drop it if noone respons after 1 sec
-			}
-		case c := <-s.register:
-			// clear inventory and close client
-			s.mu.Lock()
-			s.inventory = make(map[string]Tag, 0)
-			s.mu.Unlock()
+	for range tick.C {
+		s.mu.Lock()
+		m := s.mode
+		s.mu.Unlock()
+		if m == modeScan && s.connected() {
+			// for each tick, real all tags in range if put in READ mode
+			s.ReadTagsInRange()
+		}
+		s.checkInputs()
+		s.checkRFIdle()
+		s.checkDiagnostics()
+	}
+}
 
-			close(s.client)
+// refresh reader info and diagnostic when older than diagnosticInterval
+func (s *server) checkDiagnostics() {
+	s.mu.Lock()
+	due := time.Since(s.diagnosticRead) >= diagnosticInterval
+	s.mu.Unlock()
+	if due {
+		s.readDiagnostics()
+	}
+}
 
-			s.mu.Lock()
-			s.client = c
-			s.mu.Unlock()
-		case c := <-s.unregister:
-			close(c)
-			s.mu.Lock()
-			s.client = make(chan EsMsg) // dummy client we can close on register
-			s.mu.Unlock()
-		default:
-			// no-op if no events since last tick
+// read reader info if not known yet, and current diagnostic
+func (s *server) readDiagnostics() {
+	if !s.connected() {
+		return
+	}
+	s.mu.Lock()
+	known := s.readerInfo != nil
+	s.mu.Unlock()
+	if !known {
+		ri, err := getReaderInfo(s.Reader)
+		if err != nil {
+			s.Log.Debugf("ERROR READING READER INFO: %v", err)
 		}
+		s.mu.Lock()
+		s.readerInfo = ri
+		s.mu.Unlock()
+	}
+	diag, err := getDiagnostic(s.Reader)
+	if err != nil {
+		s.Log.Debugf("ERROR READING DIAGNOSTIC: %v", err)
 	}
+	s.mu.Lock()
+	s.diagnostic = diag
+	s.diagnosticRead = time.Now()
+	s.mu.Unlock()
 }
@@ -0,0 +1,125 @@
+package main
+
+/*
+ * NXP originality signature (NXP_READ_SIGNATURE, CMD_ISO15693_CUSTOM)
+ *
+ * response: SIGNATURE(32), ECDSA on curve secp128r1 of the UID, least significant byte first;
+ *           reversed it is r(16), s(16). The UID itself is signed as is, not hashed.
+ *
+ * Signatures are verified against NXP's public key of ICODE SLIX2 and DNA, tags failing are
+ * likely clones. Tags without the command (other manufacturers, older ICODE chips) are not
+ * checked and have no Genuine. Results are cached by UID, like system information, also for
+ * tags refusing the command.
+ *
+ * Another public key is given with -originalityKey, e.g. that of the virtual reader's tags.
+ */
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync/atomic"
+)
+
+func hexInt(s string) *big.Int {
+	i, _ := new(big.Int).SetString(s, 16)
+	return i
+}
+
+// SEC 2 curve secp128r1, a = -3
+var secp128r1 = &elliptic.CurveParams{
+	Name:    "secp128r1",
+	BitSize: 128,
+	P:       hexInt("FFFFFFFDFFFFFFFFFFFFFFFFFFFFFFFF"),
+	N:       hexInt("FFFFFFFE0000000075A30D1B9038A115"),
+	B:       hexInt("E87579C11079F43DD824993C2CEE5ED3"),
+	Gx:      hexInt("161FF7528B899B2D0C28607CA52C5B86"),
+	Gy:      hexInt("CF5AC8395BAFEB13C02DA292DDED7A83"),
+}
+
+// public key of NXP ICODE originality signatures
+var nxpOriginalityKey = &ecdsa.PublicKey{
+	Curve: secp128r1,
+	X:     hexInt("8878A2A2D3EEC336B4F261A082BD71F9"),
+	Y:     hexInt("BE11C4E2E896648B32EFA59CEA6E59F0"),
+}
+
+// public key in hex, uncompressed point 04, X(16), Y(16); NXP's key if empty
+func parseOriginalityKey(s string) (*ecdsa.PublicKey, error) {
+	if s == "" {
+		return nxpOriginalityKey, nil
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != 33 || b[0] != 0x04 {
+		return nil, fmt.Errorf("originality key must be 33 bytes in hex, 04 followed by X and Y, not '%s'", s)
+	}
+	x, y := new(big.Int).SetBytes(b[1:17]), new(big.Int).SetBytes(b[17:])
+	if !secp128r1.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("originality key '%s' is not on curve secp128r1", s)
+	}
+	return &ecdsa.PublicKey{Curve: secp128r1, X: x, Y: y}, nil
+}
+
+// signature of UID as read from tag
+func verifySignature(key *ecdsa.PublicKey, uid, sig []byte) bool {
+	if len(sig) != 32 {
+		return false
+	}
+	rs := make([]byte, 32)
+	for i := range sig {
+		rs[i] = sig[31-i]
+	}
+	r := new(big.Int).SetBytes(rs[:16])
+	s := new(big.Int).SetBytes(rs[16:])
+	return ecdsa.Verify(key, uid, r, s)
+}
+
+// originality of NXP tag, from cache or read from tag; nil if not known
+func (s *server) genuine(t *Tag) *bool {
+	if !isNXP(t) {
+		return nil
+	}
+	s.mu.Lock()
+	g, ok := s.genuineTags[t.Mac]
+	unsigned := s.unsignedTags[t.Mac]
+	s.mu.Unlock()
+	if ok {
+		return &g
+	}
+	if unsigned {
+		return nil
+	}
+	d, err := s.nxpReader()
+	if err != nil {
+		return nil
+	}
+	sig, err := d.ReadSignature(*t)
+	if err != nil {
+		s.Log.Debugf("ERROR READING SIGNATURE %s: %v", t.Mac, err)
+		if !isConnectionError(err) {
+			// tag answered, e.g. ICODE SLIX without the command
+			s.mu.Lock()
+			if len(s.unsignedTags) >= sysInfoCacheSize {
+				s.unsignedTags = make(map[string]bool)
+			}
+			s.unsignedTags[t.Mac] = true
+			s.mu.Unlock()
+		}
+		return nil
+	}
+	g = verifySignature(s.originalityKey, t.Id, sig)
+	if !g {
+		s.Log.Printf("Tag %s failed originality check, likely counterfeit", t.Mac)
+		atomic.AddUint64(&s.Reader.Stats().Counterfeit, 1)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.genuineTags) >= sysInfoCacheSize {
+		s.genuineTags = make(map[string]bool)
+	}
+	s.genuineTags[t.Mac] = g
+	return &g
+}
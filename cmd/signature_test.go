@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestOriginalitySignature(t *testing.T) {
+	uid := []byte{0xE0, 0x04, 0x01, 0x50, 0x00, 0x00, 0x00, 0x01}
+	sig := signUID(virtualOriginalityKey, uid)
+	if !verifySignature(&virtualOriginalityKey.PublicKey, uid, sig) {
+		t.Errorf("Expected signature verified")
+	}
+	if verifySignature(nxpOriginalityKey, uid, sig) {
+		t.Errorf("Expected signature of other key refused")
+	}
+	if verifySignature(&virtualOriginalityKey.PublicKey, []byte{0xE0, 0x04, 0x01, 0x50, 0x00, 0x00, 0x00, 0x02}, sig) {
+		t.Errorf("Expected signature of other UID refused")
+	}
+
+	if k, err := parseOriginalityKey(""); err != nil || k != nxpOriginalityKey {
+		t.Errorf("Expected NXP's key by default")
+	}
+	for _, bad := range []string{"04D2F7", "05D2F71038C5D8ACDEDD34E4D9BDC0461446FE0BD1772CBC449B53F57BB0B0A5D8", "04D2F71038C5D8ACDEDD34E4D9BDC0461446FE0BD1772CBC449B53F57BB0B0A5D9"} {
+		if _, err := parseOriginalityKey(bad); err == nil {
+			t.Errorf("Expected key %s refused", bad)
+		}
+	}
+	key, err := parseOriginalityKey("04D2F71038C5D8ACDEDD34E4D9BDC0461446FE0BD1772CBC449B53F57BB0B0A5D8")
+	if err != nil || !key.Equal(&virtualOriginalityKey.PublicKey) {
+		t.Fatalf("Expected public key of virtual tags: %v", err)
+	}
+
+	r := newVirtualReader(2)
+	defer r.Close()
+	// clone with signature copied from first tag
+	r.sim.tags[1].Signature = r.sim.tags[0].Signature
+	r.sim.add(newTransponder([]byte{0xE0, 0x07, 0x01, 0x00, 0x00, 0x00, 0x00, 0x03}, 64, 4))
+	s := newServer(r, false, Logger{}, "02030000")
+	s.originalityKey = key
+	s.ReadTagsInRange()
+
+	if g := s.inventory["E0:04:01:50:00:00:00:01"].Genuine; g == nil || !*g {
+		t.Errorf("Expected genuine tag: %v", g)
+	}
+	if g := s.inventory["E0:04:01:50:00:00:00:02"].Genuine; g == nil || *g {
+		t.Errorf("Expected cloned tag not genuine: %v", g)
+	}
+	if g := s.inventory["E0:07:01:00:00:00:00:03"].Genuine; g != nil {
+		t.Errorf("Expected originality of TI tag not known: %v", *g)
+	}
+	if n := r.Stats().Counterfeit; n != 1 {
+		t.Errorf("Expected 1 counterfeit tag, got %d", n)
+	}
+	if b, _ := json.Marshal(s.inventory["E0:04:01:50:00:00:00:01"]); !bytes.Contains(b, []byte(`"Genuine":true`)) {
+		t.Errorf("Genuine missing in tag json: %s", b)
+	}
+
+	// checked once per tag
+	clone := r.sim.tags[1]
+	r.sim.remove(clone.UID)
+	s.ReadTagsInRange()
+	r.sim.add(clone)
+	s.ReadTagsInRange()
+	if g := s.inventory["E0:04:01:50:00:00:00:02"].Genuine; g == nil || *g || r.Stats().Counterfeit != 1 {
+		t.Errorf("Expected cached result for returning tag, counterfeit %d", r.Stats().Counterfeit)
+	}
+
+	// tag without the command is not asked again
+	unsigned := newTransponder([]byte{0xE0, 0x04, 0x01, 0x50, 0x00, 0x00, 0x00, 0x04}, 64, 4)
+	unsigned.Signature = nil
+	tag := Tag{Id: unsigned.UID, Mac: "E0:04:01:50:00:00:00:04"}
+	r.sim.add(unsigned)
+	if g := s.genuine(&tag); g != nil {
+		t.Errorf("Expected originality of tag without signature not known: %v", *g)
+	}
+	unsigned.Signature = signUID(virtualOriginalityKey, unsigned.UID)
+	if g := s.genuine(&tag); g != nil {
+		t.Errorf("Expected tag without signature not asked again: %v", *g)
+	}
+}
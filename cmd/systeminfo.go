@@ -0,0 +1,111 @@
+package main
+
+/*
+ * ISO15693 Get System Information (ISO15693_SYSINFO, 0x2B)
+ *
+ * request:  MODE, UID(8)
+ * response: DSFID, UID(8), AFI, MEM-SIZE(2), IC-REF
+ * MEM-SIZE: block size in bytes - 1 (bits 4-0), number of blocks - 1
+ *
+ * System information is read once for each new tag and cached by UID, see server.systemInfo
+ */
+
+import (
+	"errors"
+	"sort"
+)
+
+// tags with system information cached, cache is cleared when full
+const sysInfoCacheSize = 4096
+
+// SystemInfo is the memory layout and identifiers of a tag
+type SystemInfo struct {
+	DSFID     byte // Data Storage Format Identifier
+	AFI       byte // Application Family Identifier, e.g. 0x07 alarm on, 0xC2 alarm off
+	BlockSize int  // bytes per block
+	Blocks    int  // number of blocks
+	ICRef     byte // IC reference, chip version set by manufacturer
+}
+
+// DSFID, UID(8), AFI, MEM-SIZE(2), IC-REF
+func decodeSystemInfo(data []byte) (*SystemInfo, error) {
+	if len(data) < 13 {
+		return nil, errors.New("SYSTEM INFO: Not enough bytes")
+	}
+	return &SystemInfo{
+		DSFID:     data[0],
+		AFI:       data[9],
+		BlockSize: int(data[10]&0x1F) + 1,
+		Blocks:    int(data[11]) + 1,
+		ICRef:     data[12],
+	}, nil
+}
+
+// system information of tag, from cache or read from tag; nil if the tag does not answer
+func (s *server) systemInfo(t *Tag) *SystemInfo {
+	s.mu.Lock()
+	si, ok := s.sysInfo[t.Mac]
+	s.mu.Unlock()
+	if ok {
+		return si
+	}
+	si, err := s.Reader.GetSystemInformation(t)
+	if err != nil {
+		s.Log.Debugf("ERROR READING SYSTEM INFO %s: %v", t.Mac, err)
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sysInfo) >= sysInfoCacheSize {
+		s.sysInfo = make(map[string]*SystemInfo)
+	}
+	s.sysInfo[t.Mac] = si
+	return si
+}
+
+// keep cached AFI of tag in inventory up to date after writing it, s.mu must be held
+func (s *server) updateAFI(id string, afi byte) {
+	s.updateSystemInfo(id, func(si *SystemInfo) { si.AFI = afi })
+}
+
+// keep DSFID of tag in inventory up to date after writing it, s.mu must be held
+func (s *server) updateDSFID(id string, dsfid byte) {
+	if tag, ok := s.inventory[id]; ok {
+		tag.Dfsid = uint16(dsfid)
+		s.inventory[id] = tag
+	}
+	s.updateSystemInfo(id, func(si *SystemInfo) { si.DSFID = dsfid })
+}
+
+// add blocks to locked blocks of tag in inventory after locking them, s.mu must be held
+func (s *server) updateLockedBlocks(id string, start, n int) {
+	tag, ok := s.inventory[id]
+	if !ok {
+		return
+	}
+	locked := make(map[int]bool)
+	for _, b := range tag.LockedBlocks {
+		locked[b] = true
+	}
+	blocks := append([]int(nil), tag.LockedBlocks...)
+	for i := start; i < start+n; i++ {
+		if !locked[i] {
+			blocks = append(blocks, i)
+		}
+	}
+	sort.Ints(blocks)
+	tag.LockedBlocks = blocks
+	s.inventory[id] = tag
+}
+
+func (s *server) updateSystemInfo(id string, update func(si *SystemInfo)) {
+	tag, ok := s.inventory[id]
+	if !ok || tag.SystemInfo == nil {
+		return
+	}
+	si := *tag.SystemInfo
+	update(&si)
+	tag.SystemInfo = &si
+	s.inventory[id] = tag
+	s.sysInfo[tag.Mac] = &si
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSystemInfo(t *testing.T) {
+	r := newVirtualReader(2)
+	defer r.Close()
+	s := newServer(r, false, Logger{}, "02030000")
+
+	inv := s.ReadTagsInRange()
+	tag := inv["E0:04:01:50:00:00:00:01"]
+	want := SystemInfo{AFI: 0x07, BlockSize: virtualBlockSize, Blocks: virtualBlocks, ICRef: virtualICRef}
+	if tag.SystemInfo == nil || *tag.SystemInfo != want {
+		t.Fatalf("Wrong system info: %+v, want %+v", tag.SystemInfo, want)
+	}
+
+	// cached, not read again
+	r.sim.mu.Lock()
+	r.sim.tags[0].ICRef = 0x02
+	r.sim.mu.Unlock()
+	if si := s.systemInfo(&tag); si.ICRef != virtualICRef {
+		t.Errorf("Expected cached system info, got IC reference 0x%02X", si.ICRef)
+	}
+
+	// AFI follows alarm
+	w := httptest.NewRecorder()
+	s.alarmOff(w, httptest.NewRequest("GET", "/alarmOff", nil))
+	s.mu.Lock()
+	afi := s.inventory[tag.Mac].SystemInfo.AFI
+	s.mu.Unlock()
+	if afi != 0xC2 {
+		t.Errorf("Expected AFI 0xC2 after alarmOff, got 0x%02X", afi)
+	}
+
+	if _, err := decodeSystemInfo([]byte{0x00, 0x01}); err == nil {
+		t.Errorf("Expected error decoding short system info")
+	}
+}
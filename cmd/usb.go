@@ -0,0 +1,68 @@
+//go:build feisc
+
+package main
+
+/*
+#cgo CFLAGS: -I../drivers -g -Wall
+#cgo linux LDFLAGS: -L../drivers/linux -lfeusb -lfetcp -lfeisc
+#cgo windows LDFLAGS: -L../drivers/vc141 -lfeusb -lfetcp -lfeisc
+#cgo android LDFLAGS: -L../drivers/arm64-v8a -lfetcp -lfeusb -lfeisc -lfecom -lusb1.0
+#cgo arm64 LDFLAGS: -L../drivers/android/arm64-v8a -lfetcp -lfeusb -lfeisc -lfecom -lusb1.0
+#cgo armv7-a LDFLAGS: -L../drivers/armv7-a -lfetcp -lfeusb -lfeisc -lfecom -lstdc++ -lusb-1.0
+#cgo armv7-a CFLAGS: -mfloat-abi=hard -mfpu=vfp -mtls-dialect=gnu -march=armv7-a
+//#cgo arm LDFLAGS: -L../drivers/arm -lfeudp -lfeusb -lfeisp
+//#cgo arm CFLAGS: -mfloat-abi=hard -mfpu=vfp -march=armv6+fp
+#include <stdlib.h>
+#include "../drivers/feusb.h"
+#include "../drivers/feisc.h"
+#include "../drivers/fetcp.h"
+#include "../drivers/libusb.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"unsafe"
+)
+
+// open all FEIG readers found on USB, using the FEIG SDK
+func openUSB(lgr Logger) ([]Device, error) {
+	if iRes := C.FEUSB_Scan(C.FEUSB_SCAN_ALL, nil); iRes < 0 {
+		return nil, usbError(iRes)
+	}
+	var readers []Device
+	n := int(C.FEUSB_GetScanListSize())
+	for i := 0; i < n; i++ {
+		id, _ := strconv.ParseInt(scanListPara(i, "Device-ID"), 16, 0)
+		iPortHandle := C.FEUSB_OpenDevice(C.long(id))
+		if iPortHandle < 0 {
+			log.Printf("Could not open USB reader %X: %s", id, usbError(iPortHandle))
+			continue
+		}
+		r := newReader(iPortHandle, i)
+		r.Log = lgr
+		readers = append(readers, r)
+	}
+	if len(readers) == 0 {
+		return nil, errors.New("no USB reader found")
+	}
+	return readers, nil
+}
+
+// value of parameter (e.g. DeviceName, Device-ID, FamilyName) of reader at index in scan list
+func scanListPara(index int, para string) string {
+	resBuf := make([]C.char, 56)
+	p := C.CString(para)
+	defer C.free(unsafe.Pointer(p))
+	_ = C.FEUSB_GetScanListPara(C.int(index), p, &resBuf[0])
+	return C.GoString(&resBuf[0])
+}
+
+func usbError(iRes C.int) error {
+	errBuf := make([]C.char, 56)
+	C.FEUSB_GetErrorText(iRes, &errBuf[0])
+	return fmt.Errorf("%d, %s", iRes, C.GoString(&errBuf[0]))
+}
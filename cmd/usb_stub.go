@@ -0,0 +1,10 @@
+//go:build !feisc
+
+package main
+
+import "errors"
+
+// USB readers need the FEIG SDK, see usb.go
+func openUSB(lgr Logger) ([]Device, error) {
+	return nil, errors.New("USB support not built in, build with -tags feisc and the FEIG SDK in ./drivers")
+}
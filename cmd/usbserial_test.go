@@ -26,20 +26,26 @@ func TestCrc16(t *testing.T) {
 	}
 }
 
+func TestDataModelCrc16(t *testing.T) {
+	// CRC-16/CCITT-FALSE check value 0x29B1
+	if got := crc16([]byte("123456789"), dataModelCRCTable); !bytes.Equal(got, []byte{0xB1, 0x29}) {
+		t.Errorf("Incorrect data model CRC: % 02X", got)
+	}
+}
+
 func TestGetReaderInfoResponse(t *testing.T) {
 	want := struct {
 		in  []byte
-		out *rInfo
+		out *FirmwareInfo
 	}{
 		[]byte{0x02, 0x00, 0x13, 0x00, 0x66, 0x00, 0x02, 0x06, 0x00, 0x0B, 0x4D, 0x00, 0x09, 0x01, 0x18, 0x02, 0x00, 0x95, 0x96},
-		&rInfo{
-			Status:          respStatus[STATUS_OK],
-			Swrev:           0x206,
-			Drev:            0,
-			Rxbuf:           0x4d00,
-			Txbuf:           0x901,
-			Usb:             false,
-			OnePointTwoWatt: false,
+		&FirmwareInfo{
+			Version: "02.06.00",
+			HwType:  0x0B,
+			SwType:  0x4D,
+			TrTypes: 0x0009,
+			RxBuf:   0x0118,
+			TxBuf:   0x0200,
 		},
 	}
 	got, _ := getSerialReaderInfo(want.in)
@@ -62,15 +68,15 @@ func TestGetInventoryResponse(t *testing.T) {
 				Status: respStatus[STATUS_RF_COMMUNICATION_ERROR], // TODO: this must be wrong!
 				Count:  3,
 				Tags: map[string]Tag{
-					"E0:04:01:50:33:09:CE:74": {Trtype: 3, Dfsid: 0, Id: []byte{0xE0, 0x04, 0x01, 0x50, 0x33, 0x09, 0xCE, 0x74}, Content: TagContent{}},
-					"E0:04:01:00:46:70:7A:28": {Trtype: 3, Dfsid: 0, Id: []byte{0xE0, 0x04, 0x01, 0x00, 0x46, 0x70, 0x7A, 0x28}, Content: TagContent{}},
-					"E0:04:01:50:0B:21:97:24": {Trtype: 3, Dfsid: 0, Id: []byte{0xE0, 0x04, 0x01, 0x50, 0x0B, 0x21, 0x97, 0x24}, Content: TagContent{}},
+					"E0:04:01:50:33:09:CE:74": {Trtype: 3, Dfsid: 0, Id: []byte{0xE0, 0x04, 0x01, 0x50, 0x33, 0x09, 0xCE, 0x74}, Mac: "E0:04:01:50:33:09:CE:74", Content: TagContent{}},
+					"E0:04:01:00:46:70:7A:28": {Trtype: 3, Dfsid: 0, Id: []byte{0xE0, 0x04, 0x01, 0x00, 0x46, 0x70, 0x7A, 0x28}, Mac: "E0:04:01:00:46:70:7A:28", Content: TagContent{}},
+					"E0:04:01:50:0B:21:97:24": {Trtype: 3, Dfsid: 0, Id: []byte{0xE0, 0x04, 0x01, 0x50, 0x0B, 0x21, 0x97, 0x24}, Mac: "E0:04:01:50:0B:21:97:24", Content: TagContent{}},
 				},
 			},
 		},
 	}
 	for _, w := range wants {
-		got, _ := getInventory(w.in)
+		got, _ := getSerialInventory(w.in)
 		if cmp.Equal(got, w.out) != true {
 			t.Errorf("Wrong Inventory Response:\ngot:  %#v\nwant: %#v\n", got, w.out)
 		}
@@ -0,0 +1,771 @@
+package main
+
+/*
+ * Virtual reader with simulated ISO15693 transponders
+ * The simulator answers host protocol frames in-process, so the full
+ * ISCReader stack is exercised without hardware, e.g. for frontend development and CI
+ */
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	virtualBlocks    = 28 // ICODE SLIX: 28 blocks of 4 bytes
+	virtualBlockSize = 4
+	virtualICRef     = 0x01
+	virtualRSSI      = 0x40
+
+	virtualConfigBlocks    = 16
+	virtualConfigBlockSize = 14
+)
+
+// transponder is a simulated ISO15693 tag
+type transponder struct {
+	UID              []byte
+	DSFID            byte
+	AFI              byte
+	ICRef            byte
+	BlockSize        int
+	Blocks           [][]byte // block data as sent by host, i.e. reversed
+	BlockLocked      []bool
+	AFILocked        bool
+	DSFIDLocked      bool
+	EAS              bool // NXP EAS bit
+	EASLocked        bool
+	Passwords        map[byte][]byte // NXP passwords by password id, 00000000 if not set
+	Privacy          bool            // NXP privacy mode, silent but for Get Random Number and Set Password
+	EASAFIProtected  bool            // NXP EAS and AFI need the easafi password
+	Signature        []byte          // NXP originality signature as read, signed with virtualOriginalityKey
+	ProtectPointer   byte            // NXP protect page: blocks from pointer are the high page
+	ProtectCondition byte            // NXP protect page: read (bits 0, 4) and write (bits 1, 5) protection of low and high page
+	SingleBlock      bool            // no Write Multiple Blocks, like some ICODE SLIX and Tag-it chips
+	Antenna          byte            // antenna number (1-8) transponder is in field of
+	quiet            bool
+	writes           int           // blocks written
+	random           []byte        // last random number from Get Random Number
+	unlocked         map[byte]bool // passwords set since power up
+}
+
+func newTransponder(uid []byte, blocks, blockSize int) *transponder {
+	t := &transponder{
+		UID:         uid,
+		ICRef:       virtualICRef,
+		Antenna:     1,
+		BlockSize:   blockSize,
+		Blocks:      make([][]byte, blocks),
+		BlockLocked: make([]bool, blocks),
+	}
+	for i := range t.Blocks {
+		t.Blocks[i] = make([]byte, blockSize)
+	}
+	if bytes.HasPrefix(uid, nxpPrefix) {
+		t.Signature = signUID(virtualOriginalityKey, uid)
+	}
+	return t
+}
+
+// virtual tags are not signed by NXP, but by a fixed key of their own, see -originalityKey
+var virtualOriginalityKey = func() *ecdsa.PrivateKey {
+	k := &ecdsa.PrivateKey{D: hexInt("46454947494E47205649525455414C21")}
+	k.Curve = secp128r1
+	k.X, k.Y = secp128r1.ScalarBaseMult(k.D.Bytes())
+	return k
+}()
+
+// originality signature of UID, as read from tag
+func signUID(key *ecdsa.PrivateKey, uid []byte) []byte {
+	r, s, err := ecdsa.Sign(crand.Reader, key, uid)
+	if err != nil {
+		return nil
+	}
+	rs := make([]byte, 32)
+	r.FillBytes(rs[:16])
+	s.FillBytes(rs[16:])
+	sig := make([]byte, 32)
+	for i := range rs {
+		sig[i] = rs[31-i]
+	}
+	return sig
+}
+
+// SW-REV(2), D-REV, HW-TYPE, SW-TYPE, TR-TYPE(2), RX-BUF(2), TX-BUF(2), as answered by an ID ISC.MR101
+var virtualReaderInfo = []byte{0x02, 0x06, 0x00, 0x0B, 0x4D, 0x00, 0x09, 0x01, 0x18, 0x02, 0x00}
+
+// other reader info modes and diagnostic of virtual reader, see readerinfo.go
+var virtualReaderInfoModes = map[byte][]byte{
+	READER_INFO_RF_CONTROLLER: virtualReaderInfo,
+	READER_INFO_CPU:           {0x01, 0x03, 0x00, 0x0B, 0x4D, 0x00, 0x09, 0x01, 0x18, 0x02, 0x00},
+	READER_INFO_HARDWARE:      {0x00, 0x21, 0x4D, 0x02, 0x00},
+	READER_INFO_IO:            {0x02, 0x02, 0x01},
+}
+
+// simulator keeps the transponders in the field of a virtual reader
+type simulator struct {
+	Address    byte
+	DropWrites int  // number of write requests left unanswered, like a reader timing out
+	MaxRecords int  // data sets per inventory response, 0 is unlimited
+	DiagFlags  byte // FLAGS-A of diagnostic, e.g. 0x20 for antenna impedance too high
+	Inputs     byte // INP-STATE, bit 0 is input 1
+	Log        Logger
+	tags       []*transponder
+	pending    []*transponder // inventory data sets not yet sent, see STATUS_MORE_DATA_AVAILABLE
+	config     [2][][]byte    // configuration blocks in RAM and EEPROM
+	rfOff      bool
+	buffer     []*transponder // data buffer in Buffered Read Mode
+	bufferRead int            // records sent, removed on CMD_CLEAR_BUFFER
+	outputs    map[byte]byte  // OUT-S of outputs set, by OUT-NR
+	mu         sync.Mutex
+}
+
+// create simulator with n transponders in field, each with a barcode in the data model of Danish standard, country NO
+func newSimulator(n int) *simulator {
+	sim := &simulator{}
+	for loc := range sim.config {
+		sim.config[loc] = make([][]byte, virtualConfigBlocks)
+		for i := range sim.config[loc] {
+			sim.config[loc][i] = make([]byte, virtualConfigBlockSize)
+		}
+	}
+	for i := 0; i < n; i++ {
+		uid := []byte{0xE0, 0x04, 0x01, 0x50, 0x00, 0x00}
+		uid = append(uid, u16tob(uint16(i+1))...)
+		t := newTransponder(uid, virtualBlocks, virtualBlockSize)
+		tc := TagContent{
+			SeqNum:   1,
+			NumItems: 1,
+			Barcode:  fmt.Sprintf("0301%010d", i+1),
+			Country:  "NO",
+			Library:  "02030000",
+		}
+		bs, _ := tc.ToBytes()
+		for j := 0; j < len(bs)/virtualBlockSize; j++ {
+			copy(t.Blocks[j], bs[j*virtualBlockSize:])
+		}
+		t.AFI = 0x07
+		sim.add(t)
+	}
+	return sim
+}
+
+func (sim *simulator) add(t *transponder) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.tags = append(sim.tags, t)
+}
+
+func (sim *simulator) remove(uid []byte) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	for i, t := range sim.tags {
+		if bytes.Equal(t.UID, uid) {
+			sim.tags = append(sim.tags[:i], sim.tags[i+1:]...)
+			return
+		}
+	}
+}
+
+func (sim *simulator) find(uid []byte) *transponder {
+	for _, t := range sim.tags {
+		if bytes.Equal(t.UID, uid) {
+			return t
+		}
+	}
+	return nil
+}
+
+// read request frames and answer them, until conn is closed
+func (sim *simulator) serve(conn io.ReadWriter) error {
+	fr := newFrameReader(conn)
+	for {
+		// corrupt frames are skipped, a reader does not answer them
+		b, err := fr.ReadFrame(time.Time{})
+		if err != nil {
+			return err
+		}
+		sim.Log.Debugf("EMULATOR << % 02X", b)
+		// request has no status byte: STX LENGTH(2) ADDR CMD DATA CRC16(2)
+		cmd, data := b[4], b[5:len(b)-2]
+		if sim.dropResponse(cmd, data) {
+			sim.Log.Debugf("EMULATOR: not answering write request")
+			continue
+		}
+		status, res := sim.command(cmd, data)
+		tx := encodeFrame(sim.Address, append([]byte{cmd, status}, res...))
+		sim.Log.Debugf("EMULATOR >> % 02X (%s)", tx, respStatus[status])
+		if _, err := conn.Write(tx); err != nil {
+			return err
+		}
+	}
+}
+
+// command handles a single host command, returns status and response data
+func (sim *simulator) command(cmd byte, data []byte) (byte, []byte) {
+	switch cmd {
+	case CMD_BAUDRATE:
+		return STATUS_OK, nil
+	case CMD_SW_VERSION:
+		return STATUS_OK, virtualReaderInfo
+	case CMD_GET_READER_INFO:
+		if len(data) < 1 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		if info, ok := virtualReaderInfoModes[data[0]]; ok {
+			return STATUS_OK, info
+		}
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	case CMD_DIAGNOSTIC:
+		if len(data) < 1 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		switch data[0] {
+		case DIAGNOSTIC_GENERAL:
+			return STATUS_OK, []byte{sim.DiagFlags, 0x00}
+		case DIAGNOSTIC_INTERNAL:
+			return STATUS_OK, []byte{0x00, 0x00}
+		}
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	case CMD_READ_CONFIG, CMD_WRITE_CONFIG, CMD_SAVE_CONFIG:
+		return sim.configuration(cmd, data)
+	case CMD_READ_BUFFER, CMD_CLEAR_BUFFER, CMD_INIT_BUFFER:
+		return sim.bufferedRead(cmd, data)
+	case CMD_CTRL_SOFT_RESET:
+		// restart with configuration from EEPROM
+		sim.mu.Lock()
+		for i := range sim.config[0] {
+			copy(sim.config[0][i], sim.config[1][i])
+		}
+		sim.rfOff = false
+		sim.mu.Unlock()
+		return STATUS_OK, nil
+	case CMD_CTRL_SYST_RESET, CMD_RF_RESET:
+		sim.mu.Lock()
+		sim.powerDown()
+		sim.mu.Unlock()
+		return STATUS_OK, nil
+	case CMD_RF_ONOFF:
+		if len(data) < 1 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		sim.mu.Lock()
+		sim.rfOff = data[0] == 0x00
+		if sim.rfOff {
+			sim.powerDown()
+		}
+		sim.mu.Unlock()
+		return STATUS_OK, nil
+	case CMD_GET_INPUT:
+		sim.mu.Lock()
+		defer sim.mu.Unlock()
+		return STATUS_OK, []byte{sim.Inputs}
+	case CMD_SET_OUTPUT:
+		return sim.setOutputs(data)
+	case CMD_ISO15693:
+		return sim.iso15693(0, data)
+	case CMD_ISO15693_CUSTOM:
+		if len(data) < 1 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		return sim.iso15693(data[0], data[1:])
+	}
+	return STATUS_UNKNOWN_COMMAND, nil
+}
+
+// MODE, OUT-N, {OUT-NR, OUT-S, OUT-TIME(2)}, for the outputs and relays of READER_INFO_IO
+func (sim *simulator) setOutputs(data []byte) (byte, []byte) {
+	if len(data) < 2 || data[0] != 0x01 || len(data) != 2+4*int(data[1]) {
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	}
+	io := virtualReaderInfoModes[READER_INFO_IO]
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	if sim.outputs == nil {
+		sim.outputs = make(map[byte]byte)
+	}
+	for rec := data[2:]; len(rec) > 0; rec = rec[4:] {
+		n := rec[0] & 0x1F
+		switch {
+		case rec[0]&0xE0 == OUTPUT_TYPE_OUT && n >= 1 && n <= io[1]:
+		case rec[0]&0xE0 == OUTPUT_TYPE_RELAY && n >= 1 && n <= io[2]:
+		default:
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		sim.outputs[rec[0]] = rec[1]
+	}
+	return STATUS_OK, nil
+}
+
+// configuration value of named field in RAM
+func (sim *simulator) configField(name string) uint {
+	f := configFields[name]
+	var v uint
+	for _, b := range sim.config[0][f.Block][f.Offset : f.Offset+f.Size] {
+		v = v<<8 | uint(b)
+	}
+	return v
+}
+
+/*
+Buffered Read Mode: buffer is filled with the transponders in field when read while empty,
+as if the reader had scanned them since last read
+*/
+func (sim *simulator) bufferedRead(cmd byte, data []byte) (byte, []byte) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	if sim.configField("OPERATING-MODE") != OPMODE_BUFFERED {
+		return STATUS_UNSUPPORTED_COMMAND, nil
+	}
+	switch cmd {
+	case CMD_INIT_BUFFER:
+		sim.buffer, sim.bufferRead = nil, 0
+		return STATUS_OK, nil
+	case CMD_CLEAR_BUFFER:
+		sim.buffer, sim.bufferRead = sim.buffer[sim.bufferRead:], 0
+		return STATUS_OK, nil
+	}
+	if len(data) < 2 {
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	}
+	if len(sim.buffer) == 0 && !sim.rfOff {
+		sim.buffer = append(sim.buffer, sim.tags...)
+	}
+	if len(sim.buffer) == 0 {
+		return STATUS_NO_VALID_DATA, nil
+	}
+	n := int(btou16(data[0:2]))
+	if n > len(sim.buffer) {
+		n = len(sim.buffer)
+	}
+	trData := byte(sim.configField("BRM-TR-DATA"))
+	res := append([]byte{trData}, u16tob(uint16(n))...)
+	for _, t := range sim.buffer[:n] {
+		if trData&BRM_TR_DATA_UID != 0 {
+			res = append(res, TRTYPE_ISO15693, byte(len(t.UID)))
+			res = append(res, t.UID...)
+		}
+		if trData&BRM_TR_DATA_ANT != 0 {
+			res = append(res, t.Antenna)
+		}
+		if trData&BRM_TR_DATA_TIMER != 0 {
+			res = append(res, 0x00, 0x00, 0x00, 0x00)
+		}
+	}
+	sim.bufferRead = n
+	if n < len(sim.buffer) {
+		return STATUS_MORE_DATA_AVAILABLE, res
+	}
+	return STATUS_OK, res
+}
+
+// read, write or save configuration block, CFG-ADR [CFG-REC]
+func (sim *simulator) configuration(cmd byte, data []byte) (byte, []byte) {
+	if len(data) < 1 {
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	}
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	loc, block := 0, int(data[0]&CFG_ADR_MASK)
+	if data[0]&CFG_LOC_EEPROM != 0 {
+		loc = 1
+	}
+	if block >= virtualConfigBlocks {
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	}
+	if cmd == CMD_READ_CONFIG {
+		return STATUS_OK, append([]byte{}, sim.config[loc][block]...)
+	}
+	if cmd == CMD_SAVE_CONFIG {
+		for i := range sim.config[0] {
+			if data[0]&CFG_MODE_ALL != 0 || i == block {
+				copy(sim.config[1][i], sim.config[0][i])
+			}
+		}
+		return STATUS_OK, nil
+	}
+	if len(data) != 1+virtualConfigBlockSize {
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	}
+	copy(sim.config[loc][block], data[1:])
+	return STATUS_OK, nil
+}
+
+// leave write requests unanswered while DropWrites > 0
+func (sim *simulator) dropResponse(cmd byte, data []byte) bool {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	if sim.DropWrites == 0 || cmd != CMD_ISO15693 || len(data) == 0 {
+		return false
+	}
+	if data[0] != ISO15693_WRITE_BYTES && data[0] != ISO15693_WRITE_BLOCK && data[0] != ISO15693_WRITE_AFI {
+		return false
+	}
+	sim.DropWrites--
+	return true
+}
+
+// ISO15693 command, or custom command of manufacturer mfr if not 0
+func (sim *simulator) iso15693(mfr byte, req []byte) (byte, []byte) {
+	if len(req) < 2 {
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	}
+	sub, mode, params := req[0], req[1], req[2:]
+
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	if sim.rfOff {
+		// no field, no transponders
+		return STATUS_NO_TRANSPONDER, nil
+	}
+	if sub == ISO15693_INVENTORY {
+		return sim.inventory(mode, params)
+	}
+
+	// addressed mode: UID follows mode byte
+	var t *transponder
+	if mode&0x07 == 0x01 {
+		if len(params) < 8 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		t = sim.find(params[:8])
+		params = params[8:]
+		if t == nil {
+			return STATUS_NO_TRANSPONDER, nil
+		}
+	} else if sub == ISO15693_RESET_TO_READY {
+		// non-addressed: all transponders in field wake up
+		for _, t := range sim.tags {
+			t.quiet = false
+		}
+		return STATUS_OK, nil
+	} else {
+		// non-addressed: only answered sensibly if a single transponder is in field
+		switch len(sim.tags) {
+		case 0:
+			return STATUS_NO_TRANSPONDER, nil
+		case 1:
+			t = sim.tags[0]
+		default:
+			return STATUS_RF_COMMUNICATION_ERROR, nil
+		}
+	}
+
+	if t.Privacy && !(mfr == MFR_NXP && (sub == NXP_GET_RANDOM || sub == NXP_SET_PASSWORD)) {
+		return STATUS_NO_TRANSPONDER, nil
+	}
+	if mfr != 0 {
+		return t.custom(mfr, sub, params)
+	}
+
+	switch sub {
+	case ISO15693_STAY_QUIET:
+		t.quiet = true
+		return STATUS_OK, nil
+	case ISO15693_RESET_TO_READY:
+		t.quiet = false
+		return STATUS_OK, nil
+	case ISO15693_READ_BYTES:
+		if len(params) < 2 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		return t.readBlocks(int(params[0]), int(params[1]))
+	case ISO15693_WRITE_BYTES:
+		if len(params) < 3 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		if t.SingleBlock {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_NOT_SUPPORTED}
+		}
+		return t.writeBlocks(int(params[0]), int(params[1]), int(params[2]), params[3:])
+	case ISO15693_WRITE_BLOCK:
+		if len(params) < 2 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		return t.writeBlocks(int(params[0]), 1, int(params[1]), params[2:])
+	case ISO15693_WRITE_AFI:
+		if len(params) < 1 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		if t.AFILocked {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_LOCKED}
+		}
+		if t.EASAFIProtected && !t.unlocked[NXP_PWD_EAS_AFI] {
+			return STATUS_TAG_ERROR, []byte{NXP_ERR_PROTECTED}
+		}
+		t.AFI = params[0]
+		return STATUS_OK, nil
+	case ISO15693_LOCK_AFI:
+		if t.AFILocked {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_ALREADY_LOCKED}
+		}
+		t.AFILocked = true
+		return STATUS_OK, nil
+	case ISO15693_WRITE_DSFID:
+		if len(params) < 1 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		if t.DSFIDLocked {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_LOCKED}
+		}
+		t.DSFID = params[0]
+		return STATUS_OK, nil
+	case ISO15693_LOCK_DSFID:
+		if t.DSFIDLocked {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_ALREADY_LOCKED}
+		}
+		t.DSFIDLocked = true
+		return STATUS_OK, nil
+	case ISO15693_LOCK_BLOCKS:
+		if len(params) < 2 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		start, n := int(params[0]), int(params[1])
+		if start+n > len(t.Blocks) {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_BLOCK_NOT_AVAILABLE}
+		}
+		for i := start; i < start+n; i++ {
+			t.BlockLocked[i] = true
+		}
+		return STATUS_OK, nil
+	case ISO15693_SYSINFO:
+		// DSFID, UID(8), AFI, MEM-SIZE(2), IC-REF
+		res := []byte{t.DSFID}
+		res = append(res, t.UID...)
+		res = append(res, t.AFI, byte(t.BlockSize-1), byte(len(t.Blocks)-1), t.ICRef)
+		return STATUS_OK, res
+	}
+	return STATUS_UNKNOWN_COMMAND, nil
+}
+
+// NXP custom commands, only NXP tags know them
+func (t *transponder) custom(mfr, cmd byte, params []byte) (byte, []byte) {
+	if mfr != MFR_NXP || !bytes.HasPrefix(t.UID, nxpPrefix) {
+		return STATUS_TAG_ERROR, []byte{ISO15693_ERR_NOT_SUPPORTED}
+	}
+	switch cmd {
+	case NXP_SET_EAS, NXP_RESET_EAS:
+		if t.EASLocked {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_LOCKED}
+		}
+		if t.EASAFIProtected && !t.unlocked[NXP_PWD_EAS_AFI] {
+			return STATUS_TAG_ERROR, []byte{NXP_ERR_PROTECTED}
+		}
+		t.EAS = cmd == NXP_SET_EAS
+		return STATUS_OK, nil
+	case NXP_LOCK_EAS:
+		if t.EASLocked {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_ALREADY_LOCKED}
+		}
+		t.EASLocked = true
+		return STATUS_OK, nil
+	case NXP_EAS_ALARM:
+		if !t.EAS {
+			return STATUS_NO_TRANSPONDER, nil
+		}
+		return STATUS_OK, bytes.Repeat([]byte{0xAA}, 32) // EAS sequence
+	case NXP_READ_SIGNATURE:
+		if t.Signature == nil {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_NOT_SUPPORTED}
+		}
+		return STATUS_OK, t.Signature
+	case NXP_GET_RANDOM:
+		t.random = []byte{byte(rand.Intn(256)), byte(rand.Intn(256))}
+		return STATUS_OK, t.random
+	case NXP_SET_PASSWORD:
+		if len(params) < 5 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		if t.random == nil || !bytes.Equal(t.xorPassword(params[1:5]), t.password(params[0])) {
+			// wrong password, silent until powered up again
+			return STATUS_NO_TRANSPONDER, nil
+		}
+		if t.unlocked == nil {
+			t.unlocked = make(map[byte]bool)
+		}
+		t.unlocked[params[0]] = true
+		if params[0] == NXP_PWD_PRIVACY {
+			t.Privacy = false
+		}
+		return STATUS_OK, nil
+	case NXP_WRITE_PASSWORD:
+		if len(params) < 5 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		if !t.unlocked[params[0]] {
+			return STATUS_TAG_ERROR, []byte{NXP_ERR_PROTECTED}
+		}
+		if t.Passwords == nil {
+			t.Passwords = make(map[byte][]byte)
+		}
+		t.Passwords[params[0]] = append([]byte(nil), params[1:5]...)
+		return STATUS_OK, nil
+	case NXP_PROTECT_PAGE:
+		if len(params) < 2 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		if !t.unlocked[NXP_PWD_READ] || !t.unlocked[NXP_PWD_WRITE] {
+			return STATUS_TAG_ERROR, []byte{NXP_ERR_PROTECTED}
+		}
+		t.ProtectPointer, t.ProtectCondition = params[0], params[1]
+		return STATUS_OK, nil
+	case NXP_ENABLE_PRIVACY:
+		if len(params) < 4 {
+			return STATUS_PARAMETER_LENGHT_ERROR, nil
+		}
+		if t.random == nil || !bytes.Equal(t.xorPassword(params[:4]), t.password(NXP_PWD_PRIVACY)) {
+			return STATUS_NO_TRANSPONDER, nil
+		}
+		t.Privacy = true
+		return STATUS_OK, nil
+	}
+	return STATUS_TAG_ERROR, []byte{ISO15693_ERR_NOT_SUPPORTED}
+}
+
+func (t *transponder) password(id byte) []byte {
+	if pwd, ok := t.Passwords[id]; ok {
+		return pwd
+	}
+	return []byte{0x00, 0x00, 0x00, 0x00}
+}
+
+// password sent XOR random number
+func (t *transponder) xorPassword(xp []byte) []byte {
+	return []byte{xp[0] ^ t.random[0], xp[1] ^ t.random[1], xp[2] ^ t.random[0], xp[3] ^ t.random[1]}
+}
+
+// block in page protected by Protect Page, and password not set
+func (t *transponder) protected(block int, write bool) bool {
+	cond := t.ProtectCondition
+	if block >= int(t.ProtectPointer) {
+		cond >>= 4
+	}
+	if write {
+		return cond&0x02 != 0 && !t.unlocked[NXP_PWD_WRITE]
+	}
+	return cond&0x01 != 0 && !t.unlocked[NXP_PWD_READ]
+}
+
+// RF field off: passwords set are forgotten, and tags power up in ready state
+func (sim *simulator) powerDown() {
+	for _, t := range sim.tags {
+		t.quiet = false
+		t.unlocked = nil
+		t.random = nil
+	}
+}
+
+// count, {TR-TYPE, DSFID, UID(8)}, in antenna mode followed by ANT-CNT, {ANT-NR, RSSI}
+// More than MaxRecords data sets are sent in chunks, the rest is read with the MORE mode bit
+func (sim *simulator) inventory(mode byte, params []byte) (byte, []byte) {
+	ant := mode&ISO15693_MODE_ANT != 0
+	if ant && len(params) < 1 {
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	}
+	if mode&ISO15693_MODE_MORE == 0 {
+		sim.pending = sim.pending[:0]
+		for _, t := range sim.tags {
+			if t.quiet || t.Privacy || (ant && params[0]&(1<<(t.Antenna-1)) == 0) {
+				continue
+			}
+			sim.pending = append(sim.pending, t)
+		}
+	}
+	n := len(sim.pending)
+	if n > 255 {
+		n = 255
+	}
+	if sim.MaxRecords > 0 && n > sim.MaxRecords {
+		n = sim.MaxRecords
+	}
+	if n == 0 {
+		return STATUS_NO_TRANSPONDER, nil
+	}
+	res := []byte{byte(n)}
+	for _, t := range sim.pending[:n] {
+		res = append(res, TRTYPE_ISO15693, t.DSFID)
+		res = append(res, t.UID...)
+		if ant {
+			res = append(res, 0x01, t.Antenna, virtualRSSI)
+		}
+	}
+	sim.pending = sim.pending[n:]
+	if len(sim.pending) > 0 {
+		return STATUS_MORE_DATA_AVAILABLE, res
+	}
+	return STATUS_OK, res
+}
+
+// DB-N, DB-SIZE, {SEC, DB}
+func (t *transponder) readBlocks(start, n int) (byte, []byte) {
+	if start+n > len(t.Blocks) {
+		return STATUS_TAG_ERROR, []byte{ISO15693_ERR_BLOCK_NOT_AVAILABLE}
+	}
+	for i := start; i < start+n; i++ {
+		if t.protected(i, false) {
+			return STATUS_TAG_ERROR, []byte{NXP_ERR_PROTECTED}
+		}
+	}
+	res := []byte{byte(n), byte(t.BlockSize)}
+	for i := start; i < start+n; i++ {
+		var sec byte
+		if t.BlockLocked[i] {
+			sec = 0x01
+		}
+		res = append(res, sec)
+		res = append(res, t.Blocks[i]...)
+	}
+	return STATUS_OK, res
+}
+
+func (t *transponder) writeBlocks(start, n, size int, data []byte) (byte, []byte) {
+	if size != t.BlockSize || len(data) != n*size {
+		return STATUS_PARAMETER_LENGHT_ERROR, nil
+	}
+	if start+n > len(t.Blocks) {
+		return STATUS_TAG_ERROR, []byte{ISO15693_ERR_BLOCK_NOT_AVAILABLE}
+	}
+	for i := start; i < start+n; i++ {
+		if t.BlockLocked[i] {
+			return STATUS_TAG_ERROR, []byte{ISO15693_ERR_LOCKED}
+		}
+		if t.protected(i, true) {
+			return STATUS_TAG_ERROR, []byte{NXP_ERR_PROTECTED}
+		}
+	}
+	for i := 0; i < n; i++ {
+		copy(t.Blocks[start+i], data[i*size:(i+1)*size])
+	}
+	t.writes += n
+	return STATUS_OK, nil
+}
+
+// VirtualReader is a software reader with simulated transponders
+type VirtualReader struct {
+	*ISCReader
+	sim *simulator
+}
+
+// create virtual reader with n simulated transponders in field
+func newVirtualReader(n int) *VirtualReader {
+	sim := newSimulator(n)
+	dial := func() (io.ReadWriteCloser, error) {
+		client, peer := net.Pipe()
+		go sim.serve(peer)
+		return client, nil
+	}
+	client, _ := dial()
+	r := newISCReader(client)
+	r.dial = dial
+	r.Name = "Virtual Reader"
+	r.Family = "Virtual"
+	r.Serial = "00000000"
+	return &VirtualReader{ISCReader: r, sim: sim}
+}
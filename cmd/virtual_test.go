@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVirtualReader(t *testing.T) {
+	r := newVirtualReader(2)
+	defer r.Close()
+
+	inv, err := r.ReadInventory()
+	if err != nil {
+		t.Fatalf("Inventory failed: %v", err)
+	}
+	if inv.Count != 2 || len(inv.Tags) != 2 {
+		t.Fatalf("Wrong inventory: %#v", inv)
+	}
+	tag := inv.Tags["E0:04:01:50:00:00:00:01"]
+
+	d, err := r.ReadTagContent(&tag)
+	if err != nil {
+		t.Fatalf("Read tag failed: %v", err)
+	}
+	tc, err := newTagContent(d)
+	if err != nil {
+		t.Fatalf("Wrong tag content: %v", err)
+	}
+	if tc.Barcode != "03010000000001" || tc.Library != "02030000" {
+		t.Errorf("Wrong tag content: %#v", tc)
+	}
+
+	tag.Content.Barcode = "03011339851014"
+	if _, err := r.WriteTagContent(tag); err != nil {
+		t.Fatalf("Write tag failed: %v", err)
+	}
+	d, _ = r.ReadTagContent(&tag)
+	if tc, _ := newTagContent(d); tc.Barcode != tag.Content.Barcode {
+		t.Errorf("Wrong barcode after write: %s", tc.Barcode)
+	}
+
+	if err := r.WriteAFIByte(tag, 0xC2); err != nil {
+		t.Fatalf("Write AFI failed: %v", err)
+	}
+	r.sim.mu.Lock()
+	tp := r.sim.find(tag.Id)
+	afi := tp.AFI
+	r.sim.mu.Unlock()
+	if afi != 0xC2 {
+		t.Errorf("Wrong AFI: 0x%02X", afi)
+	}
+
+	// locked blocks can not be written
+	r.sim.mu.Lock()
+	tp.BlockLocked[0] = true
+	r.sim.mu.Unlock()
+	tag.Content.SeqNum = 2 // in block 0
+	if _, err = r.WriteTagContent(tag); !errors.Is(err, ErrBlockLocked) {
+		t.Errorf("Expected locked block error, got: %v", err)
+	}
+
+	// removed tags are no longer in inventory
+	r.sim.remove(tag.Id)
+	inv, _ = r.ReadInventory()
+	if _, ok := inv.Tags[tag.Mac]; ok || inv.Count != 1 {
+		t.Errorf("Removed tag still in inventory: %#v", inv)
+	}
+}
+
+func TestVirtualReaderMoreData(t *testing.T) {
+	r := newVirtualReader(300)
+	defer r.Close()
+	r.sim.MaxRecords = 16
+
+	inv, err := r.ReadInventory()
+	if err != nil {
+		t.Fatalf("Inventory failed: %v", err)
+	}
+	if inv.Count != 300 || len(inv.Tags) != 300 {
+		t.Errorf("Wrong inventory count: %d, %d tags", inv.Count, len(inv.Tags))
+	}
+	if inv.Status != respStatus[STATUS_OK] {
+		t.Errorf("Wrong inventory status: %s", inv.Status)
+	}
+}
+
+func TestVirtualReaderTruncatedInventory(t *testing.T) {
+	r := newVirtualReader(maxInventoryReads + 1)
+	defer r.Close()
+	r.sim.MaxRecords = 1
+
+	inv, err := r.ReadInventory()
+	if !errors.Is(err, ErrInventoryTruncated) {
+		t.Errorf("Expected truncated inventory, got %v", err)
+	}
+	if len(inv.Tags) != maxInventoryReads {
+		t.Errorf("Expected tags read so far, got %d", len(inv.Tags))
+	}
+
+	s := newServer(r, false, Logger{}, "02030000")
+	s.ReadTagsInRange()
+	if st := r.Stats(); st.ReadInvFail != 1 || st.ReadInvSucc != 0 {
+		t.Errorf("Expected truncated inventory counted as failure: %+v", st)
+	}
+	if len(s.inventory) != maxInventoryReads || s.conn != connConnected {
+		t.Errorf("Expected tags read so far processed, reader connected: %d tags", len(s.inventory))
+	}
+}
+
+func TestVirtualReaderAntennas(t *testing.T) {
+	r := newVirtualReader(3)
+	defer r.Close()
+	r.sim.mu.Lock()
+	r.sim.tags[1].Antenna = 2
+	r.sim.tags[2].Antenna = 3
+	r.sim.mu.Unlock()
+
+	ants, err := parseAntennas("2,3")
+	if err != nil || ants != 0x06 {
+		t.Fatalf("Wrong antenna mask: 0x%02X, %v", ants, err)
+	}
+	r.SetAntennas(ants)
+	inv, err := r.ReadInventory()
+	if err != nil {
+		t.Fatalf("Inventory failed: %v", err)
+	}
+	if inv.Count != 2 {
+		t.Fatalf("Wrong inventory count: %d", inv.Count)
+	}
+	if a := inv.Tags["E0:04:01:50:00:00:00:03"].Antenna; a != 3 {
+		t.Errorf("Wrong antenna: %d", a)
+	}
+	if _, err := parseAntennas("1,9"); err == nil {
+		t.Errorf("Expected error on antenna 9")
+	}
+}
+
+func TestTagMoved(t *testing.T) {
+	r := newVirtualReader(1)
+	defer r.Close()
+	r.SetAntennas(0x03)
+	s := newServer(r, false, Logger{}, "02030000")
+	s.ReadTagsInRange()
+	<-s.broadcast // addTag
+
+	r.sim.mu.Lock()
+	r.sim.tags[0].Antenna = 2
+	r.sim.mu.Unlock()
+	s.ReadTagsInRange()
+	select {
+	case msg := <-s.broadcast:
+		var tag Tag
+		if err := json.Unmarshal(msg.Data, &tag); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Event != "tagMoved" || tag.Antenna != 2 {
+			t.Errorf("Expected tagMoved event to antenna 2, got: %s %s", msg.Event, msg.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected tagMoved event")
+	}
+
+	s.ReadTagsInRange()
+	select {
+	case msg := <-s.broadcast:
+		t.Errorf("Expected no event without move, got: %s %s", msg.Event, msg.Data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+/*
+ * Writing tag content in blocks
+ *
+ * Blocks are read first and only changed blocks are written, each run of consecutive
+ * changed blocks with Write Multiple Blocks. Tags not supporting it (some ICODE SLIX and
+ * Tag-it chips) are written block by block with Write Single Block, each block retried
+ * on its own.
+ *
+ * Blocks can be locked permanently. Security status of each block comes with every read,
+ * writes touching locked blocks are refused before anything is written. Tags whose blocks
+ * can not be read are checked against locked blocks read with inventory, or not written.
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// tries for each block in single block writes
+const blockWriteTries = 5
+
+var ErrBlockLocked error = errors.New("block is locked")
+
+// blockIO reads and writes raw tag blocks, data as sent to the tag (block bytes reversed)
+type blockIO interface {
+	readBlocks(t *Tag, start, n int) ([]byte, []bool, error) // data and locked status of each block
+	writeBlocks(t *Tag, start, n, size int, data []byte) error
+	writeBlock(t *Tag, block, size int, data []byte) error
+}
+
+// tag or reader does not support the command
+func isNotSupported(err error) bool {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.Status {
+	case STATUS_UNKNOWN_COMMAND, STATUS_UNSUPPORTED_COMMAND:
+		return true
+	case STATUS_TAG_ERROR:
+		return se.TagError == ISO15693_ERR_NOT_SUPPORTED
+	}
+	return false
+}
+
+// tag refused write of locked block
+func isLocked(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Status == STATUS_TAG_ERROR && se.TagError == ISO15693_ERR_LOCKED
+}
+
+// NXP tag refused access without password, see passwords.go
+func isProtected(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Status == STATUS_TAG_ERROR && se.TagError == NXP_ERR_PROTECTED
+}
+
+// write data model of tag, only blocks with changed content
+func writeContent(b blockIO, t *Tag) error {
+	n, sz, data, err := contentBlocks(t)
+	if err != nil {
+		return err
+	}
+	size := int(sz)
+	changed := make([]bool, n)
+	cur, locked, err := b.readBlocks(t, 0, int(n))
+	if err != nil || len(cur) != len(data) {
+		// content not known, write all unless locked blocks read with inventory are among them
+		if t.LockedBlocks == nil {
+			if err == nil {
+				err = fmt.Errorf("read %d bytes of %d", len(cur), len(data))
+			}
+			return fmt.Errorf("reading blocks before write: %w", err)
+		}
+		for _, i := range t.LockedBlocks {
+			if i < len(changed) {
+				return fmt.Errorf("%w: block %d of tag %s", ErrBlockLocked, i, t.Mac)
+			}
+		}
+		for i := range changed {
+			changed[i] = true
+		}
+	} else {
+		for i := range changed {
+			changed[i] = !bytes.Equal(cur[i*size:(i+1)*size], data[i*size:(i+1)*size])
+			if changed[i] && locked[i] {
+				return fmt.Errorf("%w: block %d of tag %s", ErrBlockLocked, i, t.Mac)
+			}
+		}
+	}
+
+	// runs of consecutive changed blocks, unchanged blocks between them are left alone
+	first := 0
+	for first < len(changed) {
+		if !changed[first] {
+			first++
+			continue
+		}
+		last := first
+		for last+1 < len(changed) && changed[last+1] {
+			last++
+		}
+		err = b.writeBlocks(t, first, last-first+1, size, data[first*size:(last+1)*size])
+		if isNotSupported(err) {
+			return writeSingleBlocks(b, t, first, changed, size, data)
+		}
+		if err != nil {
+			return err
+		}
+		first = last + 1
+	}
+	return nil
+}
+
+// write changed blocks from block first one by one, each retried on its own
+func writeSingleBlocks(b blockIO, t *Tag, first int, changed []bool, size int, data []byte) error {
+	var err error
+	for i := first; i < len(changed); i++ {
+		if !changed[i] {
+			continue
+		}
+		for try := 0; try < blockWriteTries; try++ {
+			err = b.writeBlock(t, i, size, data[i*size:(i+1)*size])
+			if err == nil || isNotSupported(err) || isLocked(err) || isProtected(err) {
+				break
+			}
+			time.Sleep(time.Millisecond * 50)
+		}
+		if err != nil {
+			return fmt.Errorf("writing block %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// DB-N, DB-SIZE, {SEC, DB}: block data, and locked status from security byte of each block
+func decodeBlocks(d []byte) ([]byte, []bool, error) {
+	if len(d) < 2 {
+		return nil, nil, errors.New("READ BLOCKS: Not enough bytes")
+	}
+	n, size := int(d[0]), int(d[1])
+	if len(d) < 2+n*(1+size) {
+		return nil, nil, errors.New("READ BLOCKS: Not enough bytes")
+	}
+	data := make([]byte, 0, n*size)
+	locked := make([]bool, n)
+	for i := 0; i < n; i++ {
+		rec := d[2+i*(1+size) : 2+(i+1)*(1+size)]
+		locked[i] = rec[0]&0x01 != 0
+		data = append(data, rec[1:]...)
+	}
+	return data, locked, nil
+}
+
+// numbers of locked blocks, from block start; empty if none are locked, nil is not known
+func lockedBlocks(start int, locked []bool) []int {
+	blocks := []int{}
+	for i, l := range locked {
+		if l {
+			blocks = append(blocks, start+i)
+		}
+	}
+	return blocks
+}
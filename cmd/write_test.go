@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSingleBlockWrite(t *testing.T) {
+	r := newVirtualReader(2)
+	defer r.Close()
+	inv, err := r.ReadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := inv.Tags["E0:04:01:50:00:00:00:01"]
+	tag.Content = TagContent{SeqNum: 1, NumItems: 1, Barcode: "03010000000001", Country: "NO", Library: "02030000"}
+	tp := r.sim.find(tag.Id)
+	tp.SingleBlock = true
+
+	// barcode digits 11-14 in blocks 3 and 4, CRC in blocks 4 and 5
+	tag.Content.Barcode = "03010000009999"
+	if _, err := r.WriteTagContent(tag); err != nil {
+		t.Fatalf("Write of tag without write multiple failed: %v", err)
+	}
+	d, _ := r.ReadTagContent(&tag)
+	if tc, _ := newTagContent(d); tc.Barcode != tag.Content.Barcode {
+		t.Errorf("Wrong barcode after single block write: %s", tc.Barcode)
+	}
+	if tp.writes != 3 {
+		t.Errorf("Expected 3 changed blocks written, got %d", tp.writes)
+	}
+
+	// unchanged content is not written again
+	if _, err := r.WriteTagContent(tag); err != nil {
+		t.Fatal(err)
+	}
+	if tp.writes != 3 {
+		t.Errorf("Expected no blocks written for unchanged content, got %d", tp.writes-3)
+	}
+
+	// write to locked block is refused before writing
+	tp.BlockLocked[3] = true
+	tag.Content.Barcode = "03010000001111"
+	if _, err := r.WriteTagContent(tag); !errors.Is(err, ErrBlockLocked) {
+		t.Errorf("Expected locked block error, got: %v", err)
+	}
+	if tp.writes != 3 {
+		t.Errorf("Expected no blocks written to tag with locked block, got %d", tp.writes-3)
+	}
+	if r.WriteTagFail != 1 || r.WriteTagSucc != 2 {
+		t.Errorf("Wrong write counters: %d ok, %d failed", r.WriteTagSucc, r.WriteTagFail)
+	}
+
+	// write multiple only runs of changed blocks, number of items in block 0 and CRC in blocks 4-5
+	other := r.sim.tags[1]
+	tag = inv.Tags["E0:04:01:50:00:00:00:02"]
+	tag.Content = TagContent{SeqNum: 1, NumItems: 2, Barcode: "03010000000002", Country: "NO", Library: "02030000"}
+	if _, err := r.WriteTagContent(tag); err != nil {
+		t.Fatal(err)
+	}
+	if other.writes != 3 {
+		t.Errorf("Expected blocks 0, 4 and 5 written, got %d blocks", other.writes)
+	}
+}
+
+// blocks that can not be read, writes counted
+type unreadableBlocks struct {
+	writes int
+}
+
+func (b *unreadableBlocks) readBlocks(t *Tag, start, n int) ([]byte, []bool, error) {
+	return nil, nil, ErrTimeout
+}
+
+func (b *unreadableBlocks) writeBlocks(t *Tag, start, n, size int, data []byte) error {
+	b.writes += n
+	return nil
+}
+
+func (b *unreadableBlocks) writeBlock(t *Tag, block, size int, data []byte) error {
+	b.writes++
+	return nil
+}
+
+func TestWriteUnreadBlocks(t *testing.T) {
+	tag := Tag{Id: []byte{0xE0, 0x04, 0x01, 0x50, 0x00, 0x00, 0x00, 0x01}, Mac: "E0:04:01:50:00:00:00:01"}
+	tag.Content = TagContent{SeqNum: 1, NumItems: 1, Barcode: "03010000000001", Country: "NO", Library: "02030000"}
+
+	// locked blocks not known either, nothing written
+	b := &unreadableBlocks{}
+	if err := writeContent(b, &tag); !errors.Is(err, ErrTimeout) || b.writes != 0 {
+		t.Errorf("Expected read error and no writes, got %v, %d blocks written", err, b.writes)
+	}
+	// locked block read with inventory refuses the write
+	tag.LockedBlocks = []int{3}
+	if err := writeContent(b, &tag); !errors.Is(err, ErrBlockLocked) || b.writes != 0 {
+		t.Errorf("Expected locked block error and no writes, got %v, %d blocks written", err, b.writes)
+	}
+	// no locked blocks, all written
+	tag.LockedBlocks = []int{}
+	if err := writeContent(b, &tag); err != nil || b.writes != 8 {
+		t.Errorf("Expected all blocks written, got %v, %d blocks written", err, b.writes)
+	}
+}